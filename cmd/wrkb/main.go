@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -25,10 +26,131 @@ func parseConnections(input string) []int {
 	return conns
 }
 
+func parseList(input string) []string {
+	var items []string
+	for _, s := range strings.Split(input, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+func harCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "har",
+		Usage:     "Convert a HAR capture into a --scenario file",
+		ArgsUsage: "<file.har>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "o",
+				Aliases: []string{"output"},
+				Usage:   "Scenario file to write (empty = stdout)",
+			},
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Keep only entries whose host matches this regex",
+			},
+			&cli.StringFlag{
+				Name:  "path",
+				Usage: "Keep only entries whose path matches this regex",
+			},
+			&cli.StringFlag{
+				Name:  "methods",
+				Usage: "Keep only these comma-separated methods, e.g. GET,POST",
+			},
+			&cli.BoolFlag{
+				Name:  "strip-cookies",
+				Usage: "Drop Cookie headers",
+			},
+			&cli.StringSliceFlag{
+				Name:  "replace",
+				Usage: "Replace a captured value with a placeholder in URLs, headers and bodies: '<value>=<placeholder>', repeatable",
+			},
+			&cli.StringFlag{
+				Name:  "base-url",
+				Usage: "Send to this scheme://host instead of the captured one",
+			},
+			&cli.BoolFlag{
+				Name:  "sequence",
+				Usage: "Replay the entries in capture order as one sequence instead of a weighted mix",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() != 1 {
+				return cli.Exit("Usage: wrkb har [--host=<regex>] [--path=<regex>] [-o=<scenario.json>] <file.har>", 1)
+			}
+
+			opts := wrkb.HAROptions{
+				Methods:      parseList(c.String("methods")),
+				StripCookies: c.Bool("strip-cookies"),
+				BaseURL:      c.String("base-url"),
+				Sequence:     c.Bool("sequence"),
+			}
+			var err error
+			if expr := c.String("host"); expr != "" {
+				if opts.Host, err = regexp.Compile(expr); err != nil {
+					return cli.Exit(fmt.Sprintf("invalid --host: %v", err), 1)
+				}
+			}
+			if expr := c.String("path"); expr != "" {
+				if opts.Path, err = regexp.Compile(expr); err != nil {
+					return cli.Exit(fmt.Sprintf("invalid --path: %v", err), 1)
+				}
+			}
+			for _, r := range c.StringSlice("replace") {
+				value, placeholder, ok := strings.Cut(r, "=")
+				if !ok || value == "" {
+					return cli.Exit(fmt.Sprintf("invalid --replace %q, want <value>=<placeholder>", r), 1)
+				}
+				if opts.Replace == nil {
+					opts.Replace = map[string]string{}
+				}
+				opts.Replace[value] = placeholder
+			}
+
+			templates, err := wrkb.ImportHAR(c.Args().First(), opts)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			out := os.Stdout
+			if path := c.String("o"); path != "" {
+				if out, err = os.Create(path); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				defer out.Close()
+			}
+			if err := wrkb.WriteScenario(out, templates); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			if out != os.Stdout {
+				fmt.Fprintf(os.Stderr, "Scenario written to %s\n", out.Name())
+			}
+			return nil
+		},
+	}
+}
+
+// withContentType adds a Content-Type header unless one is set already.
+func withContentType(headers []string, contentType string) []string {
+	if contentType == "" {
+		return headers
+	}
+	for _, h := range headers {
+		if name, _, _ := strings.Cut(h, ":"); strings.EqualFold(strings.TrimSpace(name), "Content-Type") {
+			return headers
+		}
+	}
+	return append(headers, "Content-Type: "+contentType)
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "wrkb",
 		Usage: "Flexible load testing CLI tool for benchmarking endpoints",
+		// Repeated flags carry one value each; -H and -F values may contain commas.
+		DisableSliceFlagSeparator: true,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "p",
@@ -54,12 +176,53 @@ func main() {
 				Usage:   "Total number of requests to send (0 = unlimited)",
 				Value:   0,
 			},
+			&cli.DurationFlag{
+				Name:  "warmup",
+				Usage: "Warm-up duration per connection level, excluded from statistics (e.g. 2s)",
+			},
+			&cli.IntFlag{
+				Name:  "warmup-reqs",
+				Usage: "Warm-up request count per connection level, excluded from statistics",
+			},
 			&cli.Float64Flag{
 				Name:    "rps",
 				Aliases: []string{"rate"},
 				Usage:   "Limit total requests per second across all connections (0 = unlimited)",
 				Value:   0,
 			},
+			&cli.BoolFlag{
+				Name:  "open-loop",
+				Usage: "Send at fixed intended times set by --rps and measure latency from them (coordinated omission correction)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "stage",
+				Usage: "Load stage '<duration>[:c=<conns>][:rps=<rate>]', repeatable; ramps linearly from the previous stage (starts at a single -c value, 1 by default, and --rps)",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Sample RPS, status counts and p50/p99/max every interval during a run, e.g. 1s (0 = off)",
+			},
+			&cli.StringFlag{
+				Name:  "scenario",
+				Usage: "JSON file with weighted request templates; paths starting with / are resolved against <url>",
+			},
+			&cli.StringFlag{
+				Name:  "requests-file",
+				Usage: "JSONL corpus of requests to replay ({\"method\",\"url\",\"headers\",\"body\"} per line), - for stdin",
+			},
+			&cli.StringFlag{
+				Name:  "requests-order",
+				Usage: "Order to replay --requests-file in: sequential (once), round-robin or random",
+				Value: "sequential",
+			},
+			&cli.Int64Flag{
+				Name:  "seed",
+				Usage: "Seed placeholders, scenario template choices and the random requests order, each worker with its own stream, for reproducible runs (0 = random)",
+			},
+			&cli.StringFlag{
+				Name:  "from-curl",
+				Usage: "Take the method, URL, headers and body from a curl command line, e.g. --from-curl \"$(pbpaste)\"",
+			},
 			&cli.StringFlag{
 				Name:    "X",
 				Aliases: []string{"method"},
@@ -74,13 +237,116 @@ func main() {
 			&cli.StringFlag{
 				Name:    "d",
 				Aliases: []string{"data"},
-				Usage:   "Request body to send with POST/PUT/PATCH requests (e.g. JSON string)",
+				Usage:   "Request body to send with POST/PUT/PATCH requests (e.g. JSON string), or @file; binary files are sent byte-exact",
+			},
+			&cli.StringSliceFlag{
+				Name:    "F",
+				Aliases: []string{"form"},
+				Usage:   "multipart/form-data field 'name=value' or 'name=@file[;type=<mime>][;filename=<name>]', repeatable; implies POST",
+			},
+			&cli.BoolFlag{
+				Name:  "http2",
+				Usage: "Send requests over HTTP/2 (TLS with ALPN)",
+			},
+			&cli.BoolFlag{
+				Name:  "h2c",
+				Usage: "Send requests over cleartext HTTP/2 with prior knowledge",
+			},
+			&cli.IntFlag{
+				Name:  "streams",
+				Usage: "Concurrent HTTP/2 streams per connection; connections = ceil(conns / streams)",
+				Value: 1,
+			},
+			&cli.StringFlag{
+				Name:  "expect-status",
+				Usage: "Comma-separated status codes a response must have, e.g. 200,201",
+			},
+			&cli.StringFlag{
+				Name:  "expect-body",
+				Usage: "Substring the response body must contain",
+			},
+			&cli.StringFlag{
+				Name:  "expect-body-regex",
+				Usage: "Regular expression the response body must match",
+			},
+			&cli.StringFlag{
+				Name:  "expect-json",
+				Usage: "JSON path equality check, e.g. '$.status=ok' or 'data.items[0].id=42'",
+			},
+			&cli.StringFlag{
+				Name:  "expect-header",
+				Usage: "Response header that must be present ('X-Id') or have a value ('Content-Type: application/json')",
+			},
+			&cli.IntFlag{
+				Name:  "max-body-size",
+				Usage: "Maximum response body size in bytes (0 = unlimited)",
+			},
+			&cli.DurationFlag{
+				Name:  "connect-timeout",
+				Usage: "TCP connect (and TLS handshake) timeout",
+				Value: 3 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "read-timeout",
+				Usage: "Response read timeout (HTTP/2: time to response headers)",
+				Value: 1 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "write-timeout",
+				Usage: "Request write timeout (HTTP/1.1 only)",
+				Value: 1 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Total timeout per request including connect (0 = none)",
+			},
+			&cli.BoolFlag{
+				Name:    "k",
+				Aliases: []string{"insecure"},
+				Usage:   "Skip TLS certificate verification",
+			},
+			&cli.StringFlag{
+				Name:  "cacert",
+				Usage: "PEM file with CA certificates used to verify the server",
+			},
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "PEM client certificate for mTLS (requires --key)",
+			},
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "PEM private key for the client certificate",
+			},
+			&cli.StringFlag{
+				Name:  "sni",
+				Usage: "Override the TLS server name (SNI and certificate verification)",
+			},
+			&cli.StringFlag{
+				Name:  "tls-min",
+				Usage: "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3",
+			},
+			&cli.StringFlag{
+				Name:  "tls-max",
+				Usage: "Maximum TLS version: 1.0, 1.1, 1.2 or 1.3",
+			},
+			&cli.StringFlag{
+				Name:  "ciphers",
+				Usage: "Comma-separated TLS 1.0-1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			},
+			&cli.BoolFlag{
+				Name:  "tls-resume",
+				Usage: "Resume TLS sessions on new connections (--tls-resume=false for full handshakes)",
+				Value: true,
 			},
 			&cli.BoolFlag{
 				Name:    "v",
 				Aliases: []string{"verbose"},
 				Usage:   "Enable verbose output",
 			},
+			&cli.StringFlag{
+				Name:  "percentiles",
+				Usage: "Comma-separated latency percentiles to report, e.g. 50,75,95,99,99.99 (default 50,90,99,99.9)",
+			},
 			&cli.StringFlag{
 				Name:  "best-json",
 				Usage: "Write best benchmark result to JSON file (empty = stdout, use --best-json=)",
@@ -89,9 +355,33 @@ func main() {
 				Name:  "compare",
 				Usage: "Compare best-json against existing file and write -2.json + -compare.csv",
 			},
+			&cli.StringFlag{
+				Name:  "json",
+				Usage: "Write every result, stages included, with the best one marked, to a JSON file (empty = stdout, use --json=)",
+			},
+			&cli.StringFlag{
+				Name:  "ndjson",
+				Usage: "Like --json, one result per line (empty = stdout, use --ndjson=)",
+			},
+			&cli.StringFlag{
+				Name:  "csv",
+				Usage: "Append a row per connection level, with all percentiles and the run, target and seed, to a CSV file",
+			},
+			&cli.StringFlag{
+				Name:  "hlog",
+				Usage: "Write latency histograms to an HdrHistogram interval log (.hlog), one interval per --interval sample, or per level and stage without --interval",
+			},
+			&cli.StringFlag{
+				Name:  "hgrm",
+				Usage: "Write the percentile distribution of every level and stage to <prefix>-c<conns>[-stage<n>].hgrm",
+			},
 		},
+		Commands: []*cli.Command{harCommand()},
 		Action: func(c *cli.Context) error {
-			if c.Args().Len() < 1 {
+			scenarioPath := c.String("scenario")
+			requestsPath := c.String("requests-file")
+			fromCurl := c.String("from-curl")
+			if c.Args().Len() < 1 && scenarioPath == "" && requestsPath == "" && fromCurl == "" {
 				return cli.Exit("Usage: wrkb -p=<proc> [-c=<list>] [-t=<seconds>] [-v] [-m=<method>] <url>", 1)
 			}
 
@@ -102,35 +392,225 @@ func main() {
 			method := strings.ToUpper(c.String("X"))
 			verbose := c.Bool("v")
 			rpsLimit := c.Float64("rps")
+			openLoop := c.Bool("open-loop")
 			maxReqs := c.Int("n")
 			body := c.String("d")
 			headers := c.StringSlice("H")
+			http2 := c.Bool("http2")
+			h2c := c.Bool("h2c")
+			streams := c.Int("streams")
 			bestJSONPath := c.String("best-json")
 			writeBestJSON := c.IsSet("best-json")
 			compareBestJSON := c.Bool("compare")
-			jsonOnly := writeBestJSON && bestJSONPath == ""
+			resultsNDJSON := c.IsSet("ndjson")
+			writeResultsJSON := c.IsSet("json") || resultsNDJSON
+			resultsJSONPath := c.String("json")
+			if resultsNDJSON {
+				resultsJSONPath = c.String("ndjson")
+			}
+			switch {
+			case c.IsSet("json") && resultsNDJSON:
+				return cli.Exit("--json and --ndjson cannot be combined", 1)
+			case http2 && h2c:
+				return cli.Exit("--http2 and --h2c cannot be combined", 1)
+			case writeBestJSON && bestJSONPath == "" && writeResultsJSON && resultsJSONPath == "":
+				return cli.Exit("only one of --best-json and --json/--ndjson can write to stdout", 1)
+			}
+			jsonOnly := writeBestJSON && bestJSONPath == "" || writeResultsJSON && resultsJSONPath == ""
+			insecure := c.Bool("k")
+
+			if fromCurl != "" {
+				switch {
+				case c.Args().Len() > 0:
+					return cli.Exit("--from-curl already sets the URL, remove the <url> argument", 1)
+				case scenarioPath != "" || requestsPath != "":
+					return cli.Exit("--from-curl cannot be combined with --scenario or --requests-file", 1)
+				case c.IsSet("X") || c.IsSet("d") || c.IsSet("F"):
+					return cli.Exit("--from-curl already sets the method and body, remove -X/-d/-F", 1)
+				}
+				req, err := wrkb.ParseCurl(fromCurl)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				url, method, body = req.URL, req.Method, req.Body
+				headers = append(req.Headers, headers...)
+				insecure = insecure || req.Insecure
+			}
+
+			rawBody := false
+			if forms := c.StringSlice("F"); len(forms) > 0 {
+				if c.IsSet("d") {
+					return cli.Exit("-d and -F cannot be combined", 1)
+				}
+				var contentType string
+				var err error
+				if body, contentType, rawBody, err = wrkb.MultipartBody(forms); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				headers = withContentType(headers, contentType)
+				if !c.IsSet("X") {
+					method = "POST"
+				}
+			} else if c.IsSet("d") {
+				var contentType string
+				var err error
+				if body, contentType, rawBody, err = wrkb.LoadBody(body); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				headers = withContentType(headers, contentType)
+			}
+
+			var stages []wrkb.Stage
+			stagedRate := false
+			for _, s := range c.StringSlice("stage") {
+				stage, err := wrkb.ParseStage(s)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				stages = append(stages, stage)
+				stagedRate = stagedRate || stage.RPS >= 0
+			}
+
+			if openLoop && rpsLimit <= 0 && !stagedRate {
+				return cli.Exit("--open-loop requires --rps > 0", 1)
+			}
+			if streams < 1 {
+				return cli.Exit("--streams must be >= 1", 1)
+			}
+
+			checks, err := wrkb.CheckOptions{
+				Status:       c.String("expect-status"),
+				BodyContains: c.String("expect-body"),
+				BodyRegex:    c.String("expect-body-regex"),
+				JSON:         c.String("expect-json"),
+				Header:       c.String("expect-header"),
+				MaxBodySize:  c.Int("max-body-size"),
+			}.Checks()
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			var percentiles []float64
+			if s := c.String("percentiles"); s != "" {
+				if percentiles, err = wrkb.ParsePercentiles(s); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
+
+			var scenario []wrkb.RequestTemplate
+			if scenarioPath != "" {
+				if scenario, err = wrkb.LoadScenario(scenarioPath, url); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
+
+			var corpus *wrkb.Corpus
+			if requestsPath != "" {
+				if scenarioPath != "" {
+					return cli.Exit("--requests-file and --scenario cannot be combined", 1)
+				}
+				order, err := wrkb.ParseCorpusOrder(c.String("requests-order"))
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if requestsPath == "-" && (c.Duration("warmup") > 0 || c.Int("warmup-reqs") > 0) {
+					return cli.Exit("--warmup cannot be combined with --requests-file -, it would use up records of stdin", 1)
+				}
+				if corpus, err = wrkb.OpenCorpus(requestsPath, url, order); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
+
+			tlsConfig, err := wrkb.TLSOptions{
+				InsecureSkipVerify: insecure,
+				CAFile:             c.String("cacert"),
+				CertFile:           c.String("cert"),
+				KeyFile:            c.String("key"),
+				ServerName:         c.String("sni"),
+				MinVersion:         c.String("tls-min"),
+				MaxVersion:         c.String("tls-max"),
+				CipherSuites:       parseList(c.String("ciphers")),
+				SessionResumption:  c.Bool("tls-resume"),
+			}.Config()
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			if len(stages) > 0 {
+				if c.IsSet("c") && len(conns) > 1 {
+					return cli.Exit("--stage runs a single profile, give -c one starting connection count", 1)
+				}
+				conns = conns[:1]
+				duration = 0
+				for _, s := range stages {
+					duration += s.Duration
+				}
+			}
+
+			target := wrkb.BenchParam{URL: url, Scenario: scenario, Corpus: corpus, HTTP2: http2, H2C: h2c}
+			if err := target.CheckProtocol(); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
 
 			if !jsonOnly {
-				fmt.Printf("\n⚙️  Preparing benchmark: '%s' [%s] for %s\n", procName, method, url)
+				switch {
+				case scenario != nil:
+					fmt.Printf("\n⚙️  Preparing benchmark: '%s' scenario %s (%d requests)\n", procName, scenarioPath, len(scenario))
+				case corpus != nil:
+					fmt.Printf("\n⚙️  Preparing benchmark: '%s' replaying %s (%s)\n", procName, requestsPath, c.String("requests-order"))
+				default:
+					fmt.Printf("\n⚙️  Preparing benchmark: '%s' [%s] for %s\n", procName, method, url)
+				}
 				fmt.Printf("   Connections: %v | Duration: %v | Requests: %d | Verbose: %v\n", conns, duration, maxReqs, verbose)
+				if len(stages) > 0 {
+					fmt.Printf("   Stages: %v\n", stages)
+				}
+				if seed := c.Int64("seed"); seed != 0 {
+					fmt.Printf("   Seed: %d\n", seed)
+				}
 			}
 
 			var params []wrkb.BenchParam
 			for _, connNum := range conns {
 				params = append(params, wrkb.BenchParam{
-					ProcName:        procName,
-					ConnNum:         connNum,
-					URL:             url,
-					Method:          method,
-					Duration:        duration,
-					Verbose:         verbose,
-					RPSLimit:        rpsLimit,
-					MaxReqs:         maxReqs,
-					Body:            body,
-					Headers:         headers,
-					BestJSONPath:    bestJSONPath,
-					WriteBestJSON:   writeBestJSON,
-					CompareBestJSON: compareBestJSON,
+					ProcName:         procName,
+					ConnNum:          connNum,
+					URL:              url,
+					Method:           method,
+					Duration:         duration,
+					Verbose:          verbose,
+					RPSLimit:         rpsLimit,
+					OpenLoop:         openLoop,
+					MaxReqs:          maxReqs,
+					Stages:           stages,
+					SampleInterval:   c.Duration("interval"),
+					Scenario:         scenario,
+					Corpus:           corpus,
+					Seed:             c.Int64("seed"),
+					Warmup:           c.Duration("warmup"),
+					WarmupReqs:       c.Int("warmup-reqs"),
+					Body:             body,
+					RawBody:          rawBody,
+					Headers:          headers,
+					HTTP2:            http2,
+					H2C:              h2c,
+					StreamsPerConn:   streams,
+					ConnectTimeout:   c.Duration("connect-timeout"),
+					ReadTimeout:      c.Duration("read-timeout"),
+					WriteTimeout:     c.Duration("write-timeout"),
+					Timeout:          c.Duration("timeout"),
+					Checks:           checks,
+					Percentiles:      percentiles,
+					TLSConfig:        tlsConfig,
+					BestJSONPath:     bestJSONPath,
+					WriteBestJSON:    writeBestJSON,
+					CompareBestJSON:  compareBestJSON,
+					ResultsJSONPath:  resultsJSONPath,
+					WriteResultsJSON: writeResultsJSON,
+					ResultsNDJSON:    resultsNDJSON,
+					CSVPath:          c.String("csv"),
+					HlogPath:         c.String("hlog"),
+					HgrmPrefix:       c.String("hgrm"),
 				})
 			}
 
@@ -0,0 +1,135 @@
+package wrkb
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoadBody resolves a -d value: "@path" reads the body from a file, anything
+// else is the body itself. contentType is guessed from the file extension
+// (text/plain or application/octet-stream when it is unknown), so a file body
+// never falls back to the JSON default of inline bodies. binary reports a file
+// that is not UTF-8 text, which has to be sent byte-exact, without
+// placeholder substitution.
+func LoadBody(arg string) (body, contentType string, binary bool, err error) {
+	path, ok := strings.CutPrefix(arg, "@")
+	if !ok {
+		return arg, "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	binary = isBinary(data)
+	contentType = mime.TypeByExtension(filepath.Ext(path))
+	switch {
+	case contentType != "":
+	case binary:
+		contentType = "application/octet-stream"
+	default:
+		contentType = "text/plain; charset=utf-8"
+	}
+	return string(data), contentType, binary, nil
+}
+
+func isBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0
+}
+
+// MultipartBody builds a multipart/form-data body, with a random boundary,
+// from curl style -F fields: "name=value", or "name=@path" for a file, with
+// optional ";type=<content type>" and ";filename=<name>" after the path.
+// binary reports a body with a binary file part. Such a body is sent as is,
+// so placeholders in its other parts are an error rather than left in.
+func MultipartBody(fields []string) (body, contentType string, binary bool, err error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	var templated string
+
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return "", "", false, fmt.Errorf("invalid form field %q, want name=value or name=@file", field)
+		}
+
+		path, isFile := strings.CutPrefix(value, "@")
+		if !isFile {
+			if templated == "" && hasPlaceholders(value) {
+				templated = name
+			}
+			if err := w.WriteField(name, value); err != nil {
+				return "", "", false, err
+			}
+			continue
+		}
+
+		path, params, _ := strings.Cut(path, ";")
+		filename, fileType := filepath.Base(path), mime.TypeByExtension(filepath.Ext(path))
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(param, "=")
+			switch k {
+			case "":
+			case "type":
+				fileType = v
+			case "filename":
+				filename = v
+			default:
+				return "", "", false, fmt.Errorf("invalid form field %q: unknown parameter %s", field, k)
+			}
+		}
+		if fileType == "" {
+			fileType = "application/octet-stream"
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", false, err
+		}
+		if isBinary(data) {
+			binary = true
+		} else if templated == "" && hasPlaceholders(string(data)) {
+			templated = name
+		}
+
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": name, "filename": filename}))
+		h.Set("Content-Type", fileType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return "", "", false, err
+		}
+		if _, err := part.Write(data); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	if binary && templated != "" {
+		return "", "", false, fmt.Errorf("form field %q has placeholders, which cannot be substituted in a body with a binary file", templated)
+	}
+
+	if err := w.Close(); err != nil {
+		return "", "", false, err
+	}
+	return buf.String(), w.FormDataContentType(), binary, nil
+}
+
+func hasPlaceholders(s string) bool {
+	t := compileText(s, kindAll, make(map[string]int))
+	return !t.static()
+}
+
+// printableBody keeps binary bodies out of verbose output.
+func printableBody(body []byte) string {
+	if isBinary(body) {
+		return fmt.Sprintf("[%d bytes of binary data]", len(body))
+	}
+	return string(body)
+}
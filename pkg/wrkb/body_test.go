@@ -0,0 +1,135 @@
+package wrkb
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func writeBodyFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBody(t *testing.T) {
+	body, contentType, binary, err := LoadBody(`{"a":1}`)
+	if err != nil || body != `{"a":1}` || contentType != "" || binary {
+		t.Errorf("inline body: got %q %q %v %v", body, contentType, binary, err)
+	}
+
+	body, contentType, binary, err = LoadBody("@" + writeBodyFile(t, "order.json", []byte(`{"id":__RANDI64_1_9__}`)))
+	if err != nil || body != `{"id":__RANDI64_1_9__}` || contentType != "application/json" || binary {
+		t.Errorf("text file: got %q %q %v %v", body, contentType, binary, err)
+	}
+
+	body, contentType, binary, err = LoadBody("@" + writeBodyFile(t, "payload", []byte("a,b")))
+	if err != nil || body != "a,b" || contentType != "text/plain; charset=utf-8" || binary {
+		t.Errorf("text file without extension: got %q %q %v %v", body, contentType, binary, err)
+	}
+
+	data := []byte{0x89, 'P', 'N', 'G', 0, 0xff, 0xfe}
+	body, contentType, binary, err = LoadBody("@" + writeBodyFile(t, "blob", data))
+	if err != nil || body != string(data) || contentType != "application/octet-stream" || !binary {
+		t.Errorf("binary file: got %q %q %v %v", body, contentType, binary, err)
+	}
+
+	if _, _, _, err := LoadBody("@" + filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	image := []byte{0x89, 'P', 'N', 'G', 0, 1, 2}
+	imagePath := writeBodyFile(t, "photo.bin", image)
+	notePath := writeBodyFile(t, "note.txt", []byte("hello"))
+
+	body, contentType, binary, err := MultipartBody([]string{
+		"title=a, b",
+		"photo=@" + imagePath + ";type=image/png;filename=cat.png",
+		"note=@" + notePath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !binary {
+		t.Errorf("expected a body with a binary part to be binary")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		t.Fatalf("unexpected content type %q: %v", contentType, err)
+	}
+	r := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	want := []struct{ name, filename, contentType, data string }{
+		{"title", "", "", "a, b"},
+		{"photo", "cat.png", "image/png", string(image)},
+		{"note", "note.txt", "text/plain; charset=utf-8", "hello"},
+	}
+	for _, w := range want {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		if part.FormName() != w.name || part.FileName() != w.filename || part.Header.Get("Content-Type") != w.contentType || string(data) != w.data {
+			t.Errorf("part %s: got name=%s filename=%s type=%s data=%q", w.name, part.FormName(), part.FileName(), part.Header.Get("Content-Type"), data)
+		}
+	}
+
+	if _, _, binary, err := MultipartBody([]string{"owner=__RANDI64_1_9__", "note=@" + notePath}); err != nil || binary {
+		t.Errorf("expected placeholders in a text body to be allowed, got binary=%v err=%v", binary, err)
+	}
+
+	templatePath := writeBodyFile(t, "owner.txt", []byte("owner=__RANDI64_1_9__"))
+	for _, fields := range [][]string{
+		{"novalue"},
+		{"=x"},
+		{"f=@" + notePath + ";size=1"},
+		{"f=@" + filepath.Join(t.TempDir(), "missing")},
+		{"owner=__RANDI64_1_9__", "photo=@" + imagePath},
+		{"photo=@" + imagePath, "owner=@" + templatePath},
+	} {
+		if _, _, _, err := MultipartBody(fields); err == nil {
+			t.Errorf("%v: expected error", fields)
+		}
+	}
+}
+
+func TestBenchHTTP_RawBody(t *testing.T) {
+	// A binary body that happens to contain a placeholder must not change.
+	data := append([]byte{0, 0xff}, "__RANDI64_1_9__"...)
+	var mismatched, received int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		atomic.AddInt64(&received, 1)
+		if !bytes.Equal(got, data) || r.Header.Get("Content-Type") != "application/octet-stream" {
+			atomic.AddInt64(&mismatched, 1)
+		}
+	}))
+	defer srv.Close()
+
+	body, contentType, binary, err := LoadBody("@" + writeBodyFile(t, "blob", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	BenchHTTP(BenchParam{
+		ConnNum: 1, URL: srv.URL, Method: "PUT", MaxReqs: 5,
+		Body: body, RawBody: binary, Headers: []string{"Content-Type: " + contentType},
+	})
+
+	if received == 0 || mismatched != 0 {
+		t.Fatalf("expected the body byte-exact, %d of %d requests differed", mismatched, received)
+	}
+}
@@ -0,0 +1,163 @@
+package wrkb
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+)
+
+// Extract binds a value of a response to a variable used as __VAR_<name>__
+// by later requests of the same worker. Exactly one source is set: a JSON
+// path as in --expect-json, a regular expression (its first group, or the
+// whole match) or a response header.
+type Extract struct {
+	JSON   string `json:"json"`
+	Regex  string `json:"regex"`
+	Header string `json:"header"`
+}
+
+type extractor struct {
+	name     string
+	jsonPath []string
+	re       *regexp.Regexp
+	header   string
+}
+
+func (t *RequestTemplate) compileExtract() error {
+	names := make([]string, 0, len(t.Extract))
+	for name := range t.Extract {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t.extractors = nil
+	for _, name := range names {
+		e := t.Extract[name]
+		if name == "" || e == nil {
+			return fmt.Errorf("invalid extract %q", name)
+		}
+
+		ex := extractor{name: name, header: e.Header}
+		sources := 0
+		if e.JSON != "" {
+			if ex.jsonPath = parseJSONPath(e.JSON); len(ex.jsonPath) == 0 {
+				return fmt.Errorf("extract %s: empty json path", name)
+			}
+			sources++
+		}
+		if e.Regex != "" {
+			re, err := regexp.Compile(e.Regex)
+			if err != nil {
+				return fmt.Errorf("extract %s: %w", name, err)
+			}
+			ex.re = re
+			sources++
+		}
+		if e.Header != "" {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("extract %s: set exactly one of json, regex or header", name)
+		}
+		t.extractors = append(t.extractors, ex)
+	}
+	return nil
+}
+
+func (e *extractor) needsBody() bool {
+	return e.jsonPath != nil || e.re != nil
+}
+
+func (e *extractor) value(out Outcome) (string, bool) {
+	switch {
+	case e.jsonPath != nil:
+		return jsonPathValue(out.Body, e.jsonPath)
+	case e.re != nil:
+		m := e.re.FindSubmatch(out.Body)
+		if m == nil {
+			return "", false
+		}
+		if len(m) > 1 {
+			return string(m[1]), true
+		}
+		return string(m[0]), true
+	case out.Header != nil:
+		return out.Header(e.header)
+	default:
+		return "", false
+	}
+}
+
+// extract binds the template's variables from out and returns the reason the
+// first missing value failed the request, or "".
+func (t *RequestTemplate) extract(out Outcome, vars map[string]string) string {
+	for i := range t.extractors {
+		e := &t.extractors[i]
+		v, ok := e.value(out)
+		if !ok {
+			return fmt.Sprintf("extract %s: no value", e.name)
+		}
+		vars[e.name] = v
+	}
+	return ""
+}
+
+func templatesExtract(templates []RequestTemplate) bool {
+	requests, _ := flattenTemplates(templates)
+	for _, r := range requests {
+		if len(r.extractors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func templatesNeedBody(templates []RequestTemplate) bool {
+	requests, _ := flattenTemplates(templates)
+	for _, r := range requests {
+		for i := range r.extractors {
+			if r.extractors[i].needsBody() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// render builds the request to send for t. Placeholders are substituted in
+// the method, URL, headers (names and values) and body with one substitution,
+// so named placeholders agree across them, and so are the worker's variables.
+// t is compiled on first use; newTemplatePicker compiles its requests up
+// front, as workers share them.
+func (t *RequestTemplate) render(sub *substitution, vars map[string]string) Request {
+	if t.compiled == nil {
+		t.compiled = compileRequest(t)
+	}
+	return t.compiled.render(sub, vars)
+}
+
+// sequence tracks a worker's position in the template it is sending.
+type sequence struct {
+	template int
+	step     int
+	active   bool
+}
+
+// next returns the index into picker.requests of the request to send,
+// drawing the next template from r at the start of a sequence.
+func (s *sequence) next(p *templatePicker, r *rand.Rand) int {
+	if !s.active {
+		s.template, s.step, s.active = p.pick(r), 0, true
+	}
+	return p.first[s.template] + s.step
+}
+
+// done moves to the next step, or ends the sequence after the last step or
+// when the request was not successful.
+func (s *sequence) done(p *templatePicker, ok bool) {
+	s.step++
+	if !ok || s.step >= max(len(p.templates[s.template].Steps), 1) {
+		s.active = false
+	}
+}
@@ -0,0 +1,117 @@
+package wrkb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tmpl := RequestTemplate{
+		URL: "http://a/",
+		Extract: map[string]*Extract{
+			"token": {JSON: "$.data.token"},
+			"id":    {Regex: `"id":(\d+)`},
+			"sid":   {Header: "X-Session"},
+		},
+	}
+	if err := tmpl.normalize(""); err != nil {
+		t.Fatal(err)
+	}
+
+	out := Outcome{
+		Status: 200,
+		Body:   []byte(`{"id":42,"data":{"token":"abc"}}`),
+		Header: func(name string) (string, bool) { return "s-1", name == "X-Session" },
+	}
+	vars := map[string]string{}
+	if reason := tmpl.extract(out, vars); reason != "" {
+		t.Fatalf("unexpected failure: %s", reason)
+	}
+	if vars["token"] != "abc" || vars["id"] != "42" || vars["sid"] != "s-1" {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+
+	out.Body = []byte(`{}`)
+	if reason := tmpl.extract(out, vars); reason != "extract id: no value" {
+		t.Fatalf("expected a missing id, got %q", reason)
+	}
+}
+
+func TestExtract_Errors(t *testing.T) {
+	for _, e := range []*Extract{
+		{},
+		{JSON: "$", Header: "X"},
+		{Regex: "("},
+		{JSON: "$."},
+	} {
+		tmpl := RequestTemplate{URL: "http://a/", Extract: map[string]*Extract{"v": e}}
+		if err := tmpl.normalize(""); err == nil {
+			t.Errorf("expected error for %+v", e)
+		}
+	}
+}
+
+func TestSubstituteVars(t *testing.T) {
+	vars := map[string]string{"token": "abc", "user_id": "7"}
+	tmpl := RequestTemplate{
+		URL:     "/users/__VAR_user_id__?t=__VAR_token__&x=__VAR_other__",
+		Headers: []string{"Accept: */*", "Authorization: Bearer __VAR_token__"},
+	}
+
+	var sub substitution
+	req := tmpl.render(&sub, vars)
+	if req.URL != "/users/7?t=abc&x=__VAR_other__" {
+		t.Fatalf("unexpected url: %s", req.URL)
+	}
+	if got := req.Headers; got[0] != "Accept: */*" || got[1] != "Authorization: Bearer abc" || tmpl.Headers[1] != "Authorization: Bearer __VAR_token__" {
+		t.Fatalf("unexpected headers: %v (template %v)", got, tmpl.Headers)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl := RequestTemplate{
+		Method:  "__RANDSTR_letters_3#verb__",
+		URL:     "http://a/__RANDHEX_12#rid__?u=__VAR_user__",
+		Headers: []string{"Accept: */*", "X-Request-ID: __RANDHEX_12#rid__", "X-Tenant-__RANDI64_1_1__: t__RANDI64_5_5__"},
+		Body:    `{"verb":"__RANDSTR_letters_3#verb__","rid":"__RANDHEX_12#rid__"}`,
+	}
+	var sub substitution
+	req := tmpl.render(&sub, map[string]string{"user": "bob"})
+
+	rid := strings.TrimSuffix(strings.TrimPrefix(req.URL, "http://a/"), "?u=bob")
+	if len(rid) != 12 || req.Headers[1] != "X-Request-ID: "+rid || req.Headers[2] != "X-Tenant-1: t5" || req.Headers[0] != "Accept: */*" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if want := `{"verb":"` + req.Method + `","rid":"` + rid + `"}`; len(req.Method) != 3 || req.Body != want {
+		t.Fatalf("expected the body to reuse the method and rid, got %q (method %q)", req.Body, req.Method)
+	}
+	if tmpl.Headers[1] != "X-Request-ID: __RANDHEX_12#rid__" {
+		t.Fatalf("template headers were modified: %v", tmpl.Headers)
+	}
+
+	raw := RequestTemplate{Method: "PUT", URL: "http://a/", Body: "\x00__RANDHEX_4__", rawBody: true}
+	if req := raw.render(&sub, nil); req.Body != raw.Body {
+		t.Fatalf("expected a raw body to be sent as is, got %q", req.Body)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	p := newTemplatePicker([]RequestTemplate{
+		{Name: "flow", Weight: 1, Steps: []RequestTemplate{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+	})
+
+	var seq sequence
+	var got []string
+	for _, ok := range []bool{true, true, true, true, false, true} {
+		i := seq.next(p, nil)
+		got = append(got, p.requests[i].Name)
+		seq.done(p, ok)
+	}
+
+	want := []string{"flow/a", "flow/b", "flow/c", "flow/a", "flow/b", "flow/a"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected order %v, want %v", got, want)
+		}
+	}
+}
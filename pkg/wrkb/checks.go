@@ -0,0 +1,196 @@
+package wrkb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const maxFailReasons = 5
+
+// CheckOptions holds the response assertions as given on the command line.
+type CheckOptions struct {
+	Status       string // comma-separated status codes, e.g. "200,201"
+	BodyContains string
+	BodyRegex    string
+	JSON         string // <path>=<value>, e.g. "$.status=ok"
+	Header       string // "Name" (presence) or "Name: value"
+	MaxBodySize  int
+}
+
+// Checks are response assertions evaluated on every successful response.
+// A response that fails any of them is counted as failed instead of good/bad.
+type Checks struct {
+	Status       []int
+	BodyContains string
+	BodyRegex    *regexp.Regexp
+	JSONPath     []string
+	JSONValue    string
+	HeaderName   string
+	HeaderValue  string
+	MaxBodySize  int
+}
+
+// Checks parses the options; it returns nil when no assertion is configured.
+func (o CheckOptions) Checks() (*Checks, error) {
+	c := &Checks{
+		BodyContains: o.BodyContains,
+		MaxBodySize:  o.MaxBodySize,
+	}
+
+	for _, s := range strings.Split(o.Status, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("invalid expected status: %s", s)
+		}
+		c.Status = append(c.Status, code)
+	}
+
+	if o.BodyRegex != "" {
+		re, err := regexp.Compile(o.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body regex: %w", err)
+		}
+		c.BodyRegex = re
+	}
+
+	if o.JSON != "" {
+		path, value, ok := strings.Cut(o.JSON, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid json check %q, expected <path>=<value>", o.JSON)
+		}
+		c.JSONPath = parseJSONPath(path)
+		c.JSONValue = value
+		if len(c.JSONPath) == 0 {
+			return nil, fmt.Errorf("invalid json check %q: empty path", o.JSON)
+		}
+	}
+
+	if o.Header != "" {
+		name, value, _ := strings.Cut(o.Header, ":")
+		c.HeaderName = strings.TrimSpace(name)
+		c.HeaderValue = strings.TrimSpace(value)
+	}
+
+	if len(c.Status) == 0 && c.BodyContains == "" && c.BodyRegex == nil &&
+		c.JSONPath == nil && c.HeaderName == "" && c.MaxBodySize <= 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func (c *Checks) needsBody() bool {
+	return c != nil && (c.BodyContains != "" || c.BodyRegex != nil || c.JSONPath != nil)
+}
+
+// check returns the reason the response failed, or "" when it passed.
+func (c *Checks) check(out Outcome) string {
+	if c == nil {
+		return ""
+	}
+
+	if len(c.Status) > 0 && !slices.Contains(c.Status, out.Status) {
+		return fmt.Sprintf("status %d not in %v", out.Status, c.Status)
+	}
+	if c.MaxBodySize > 0 && out.RespBytes > c.MaxBodySize {
+		return fmt.Sprintf("body size %d > %d", out.RespBytes, c.MaxBodySize)
+	}
+	if c.HeaderName != "" {
+		var v string
+		var ok bool
+		if out.Header != nil {
+			v, ok = out.Header(c.HeaderName)
+		}
+		if !ok {
+			return fmt.Sprintf("header %s missing", c.HeaderName)
+		}
+		if c.HeaderValue != "" && v != c.HeaderValue {
+			return fmt.Sprintf("header %s = %q, want %q", c.HeaderName, v, c.HeaderValue)
+		}
+	}
+	if c.BodyContains != "" && !bytes.Contains(out.Body, []byte(c.BodyContains)) {
+		return fmt.Sprintf("body does not contain %q", c.BodyContains)
+	}
+	if c.BodyRegex != nil && !c.BodyRegex.Match(out.Body) {
+		return fmt.Sprintf("body does not match /%s/", c.BodyRegex)
+	}
+	if c.JSONPath != nil {
+		v, ok := jsonPathValue(out.Body, c.JSONPath)
+		path := strings.Join(c.JSONPath, ".")
+		if !ok {
+			return fmt.Sprintf("json %s missing", path)
+		}
+		if v != c.JSONValue {
+			return fmt.Sprintf("json %s = %s, want %s", path, v, c.JSONValue)
+		}
+	}
+	return ""
+}
+
+// parseJSONPath splits "$.data.items[0].id" or "data.items.0.id" into keys.
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var keys []string
+	for _, k := range strings.Split(path, ".") {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// jsonPathValue returns the value at path; strings are returned unquoted,
+// other values in their JSON form (42, true, null, {"a":1}).
+func jsonPathValue(body []byte, path []string) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func addFailReason(reasons []string, reason string) []string {
+	if reason == "" || len(reasons) >= maxFailReasons || slices.Contains(reasons, reason) {
+		return reasons
+	}
+	return append(reasons, reason)
+}
@@ -0,0 +1,84 @@
+package wrkb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckOptions_NoChecks(t *testing.T) {
+	checks, err := CheckOptions{}.Checks()
+	if err != nil || checks != nil {
+		t.Fatalf("expected no checks, got %+v (err=%v)", checks, err)
+	}
+}
+
+func TestCheckOptions_Errors(t *testing.T) {
+	for _, opts := range []CheckOptions{
+		{Status: "20x"},
+		{BodyRegex: "("},
+		{JSON: "$.status"},
+		{JSON: "$=ok"},
+	} {
+		if _, err := opts.Checks(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestChecks_Check(t *testing.T) {
+	headers := map[string]string{"Content-Type": "application/json"}
+	out := Outcome{
+		Status:    200,
+		Body:      []byte(`{"status":"ok","data":{"items":[{"id":42,"ok":true}]}}`),
+		RespBytes: 55,
+		Header: func(name string) (string, bool) {
+			v, ok := headers[name]
+			return v, ok
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   CheckOptions
+		reason string
+	}{
+		{"status ok", CheckOptions{Status: "200,201"}, ""},
+		{"status failed", CheckOptions{Status: "201"}, "status 200 not in [201]"},
+		{"body contains", CheckOptions{BodyContains: `"ok"`}, ""},
+		{"body missing", CheckOptions{BodyContains: "error"}, `body does not contain "error"`},
+		{"body regex", CheckOptions{BodyRegex: `"id":\d+`}, ""},
+		{"body regex failed", CheckOptions{BodyRegex: `^\[`}, `body does not match /^\[/`},
+		{"json string", CheckOptions{JSON: "$.status=ok"}, ""},
+		{"json number", CheckOptions{JSON: "data.items[0].id=42"}, ""},
+		{"json bool", CheckOptions{JSON: "$.data.items.0.ok=true"}, ""},
+		{"json mismatch", CheckOptions{JSON: "$.status=error"}, "json status = ok, want error"},
+		{"json missing", CheckOptions{JSON: "$.data.items[3].id=1"}, "json data.items.3.id missing"},
+		{"header present", CheckOptions{Header: "Content-Type"}, ""},
+		{"header value", CheckOptions{Header: "Content-Type: application/json"}, ""},
+		{"header missing", CheckOptions{Header: "X-Request-Id"}, "header X-Request-Id missing"},
+		{"header mismatch", CheckOptions{Header: "Content-Type: text/plain"}, `header Content-Type = "application/json", want "text/plain"`},
+		{"body size", CheckOptions{MaxBodySize: 10}, "body size 55 > 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks, err := tt.opts.Checks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := checks.check(out); got != tt.reason {
+				t.Fatalf("expected reason %q, got %q", tt.reason, got)
+			}
+		})
+	}
+}
+
+func TestAddFailReason_Limit(t *testing.T) {
+	var reasons []string
+	for i := 0; i < 10; i++ {
+		reasons = addFailReason(reasons, strings.Repeat("x", i%7+1))
+	}
+	if len(reasons) != maxFailReasons {
+		t.Fatalf("expected %d distinct reasons, got %v", maxFailReasons, reasons)
+	}
+}
@@ -1,6 +1,7 @@
 package wrkb
 
 import (
+	"cmp"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -23,19 +25,56 @@ type compareRow struct {
 	Cmp     int
 }
 
-func readBestResultJSON(path string) (bestResultJSON, error) {
+func readBestResultJSON(path string) (resultJSON, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return bestResultJSON{}, err
+		return resultJSON{}, err
 	}
 
-	var payload bestResultJSON
+	var payload resultJSON
 	if err := json.Unmarshal(data, &payload); err != nil {
-		return bestResultJSON{}, err
+		return resultJSON{}, err
+	}
+	if payload.Percentiles == nil && payload.CorrectedPercentiles == nil {
+		var legacy legacyPercentilesJSON
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return resultJSON{}, err
+		}
+		payload.Percentiles = legacy.percentiles("")
+		payload.CorrectedPercentiles = legacy.percentiles("Corrected")
 	}
 	return payload, nil
 }
 
+// legacyPercentilesJSON holds the fixed percentile fields of files written
+// before the percentiles were configurable.
+type legacyPercentilesJSON struct {
+	P50           *int64 `json:"p50"`
+	P90           *int64 `json:"p90"`
+	P99           *int64 `json:"p99"`
+	P999          *int64 `json:"p999"`
+	CorrectedP50  *int64 `json:"corrected_p50"`
+	CorrectedP90  *int64 `json:"corrected_p90"`
+	CorrectedP99  *int64 `json:"corrected_p99"`
+	CorrectedP999 *int64 `json:"corrected_p999"`
+}
+
+// percentiles maps the fields with the name prefix to the current labels.
+func (l legacyPercentilesJSON) percentiles(prefix string) map[string]int64 {
+	v := reflect.ValueOf(l)
+	out := map[string]int64{}
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		field := v.FieldByName(prefix + strings.ReplaceAll(strings.ToUpper(percentileLabel(p)), ".", ""))
+		if !field.IsNil() {
+			out[percentileLabel(p)] = field.Elem().Int()
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 func writeBestResultCompareCSV(path string, rows []compareRow) error {
 	file, err := os.Create(path)
 	if err != nil {
@@ -58,7 +97,7 @@ func writeBestResultCompareCSV(path string, rows []compareRow) error {
 	return writer.Error()
 }
 
-func buildCompareRows(base bestResultJSON, next bestResultJSON) []compareRow {
+func buildCompareRows(base resultJSON, next resultJSON) []compareRow {
 	baseVal := reflect.ValueOf(base)
 	nextVal := reflect.ValueOf(next)
 	structType := baseVal.Type()
@@ -73,45 +112,95 @@ func buildCompareRows(base bestResultJSON, next bestResultJSON) []compareRow {
 
 		baseField := baseVal.Field(i)
 		nextField := nextVal.Field(i)
+		if field.Type.Kind() == reflect.Map {
+			rows = append(rows, compareMaps(field, baseField, nextField)...)
+			continue
+		}
+		if field.Tag.Get("cmpOmitEmpty") == "true" && baseField.IsZero() && nextField.IsZero() {
+			continue
+		}
+		rows = append(rows, compareValues(field, label, baseField, nextField))
+	}
 
-		baseStr := formatValue(field, baseField)
-		nextStr := formatValue(field, nextField)
-
-		absDiff := ""
-		pctDiff := ""
-		cmp := 0
-		if baseNum, ok := numericValue(field, baseField); ok {
-			if nextNum, ok := numericValue(field, nextField); ok {
-				diff := nextNum - baseNum
-				absDiff = formatAbsDiff(field, math.Abs(diff))
-				if baseNum != 0 {
-					pctDiff = fmt.Sprintf("%+.2f%%", (diff/baseNum)*100)
-				} else {
-					pctDiff = fmt.Sprintf("%+.2f%%", 0.00)
-				}
-				if diff != 0 {
-					if dir, ok := compareDirection(field); ok {
-						if (dir == 1 && diff > 0) || (dir == -1 && diff < 0) {
-							cmp = 1
-						} else {
-							cmp = -1
-						}
+	return rows
+}
+
+// compareMaps compares a map field, the percentiles or the status codes, of
+// two files that may have different keys, such as percentiles written with
+// different --percentiles: every key in either file gets a row named after
+// the field's cmpPrefix and the key, in ascending numeric order, with a diff
+// when both have it.
+func compareMaps(field reflect.StructField, base, next reflect.Value) []compareRow {
+	prefix := field.Tag.Get("cmpPrefix")
+	var labels []string
+	for _, m := range []reflect.Value{base, next} {
+		for _, k := range m.MapKeys() {
+			if !slices.Contains(labels, k.String()) {
+				labels = append(labels, k.String())
+			}
+		}
+	}
+	slices.SortFunc(labels, func(a, b string) int {
+		pa, _ := strconv.ParseFloat(strings.TrimPrefix(a, "p"), 64)
+		pb, _ := strconv.ParseFloat(strings.TrimPrefix(b, "p"), 64)
+		return cmp.Compare(pa, pb)
+	})
+
+	var rows []compareRow
+	for _, label := range labels {
+		key := reflect.ValueOf(label)
+		baseValue, nextValue := base.MapIndex(key), next.MapIndex(key)
+		if baseValue.IsValid() && nextValue.IsValid() {
+			rows = append(rows, compareValues(field, prefix+label, baseValue, nextValue))
+			continue
+		}
+		row := compareRow{Field: prefix + label}
+		if baseValue.IsValid() {
+			row.Base = formatValue(field, baseValue)
+		} else {
+			row.Next = formatValue(field, nextValue)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func compareValues(field reflect.StructField, label string, baseField, nextField reflect.Value) compareRow {
+	baseStr := formatValue(field, baseField)
+	nextStr := formatValue(field, nextField)
+
+	absDiff := ""
+	pctDiff := ""
+	cmp := 0
+	if baseNum, ok := numericValue(field, baseField); ok {
+		if nextNum, ok := numericValue(field, nextField); ok {
+			diff := nextNum - baseNum
+			absDiff = formatAbsDiff(field, math.Abs(diff))
+			if baseNum != 0 {
+				pctDiff = fmt.Sprintf("%+.2f%%", (diff/baseNum)*100)
+			} else {
+				pctDiff = fmt.Sprintf("%+.2f%%", 0.00)
+			}
+			if diff != 0 {
+				if dir, ok := compareDirection(field); ok {
+					if (dir == 1 && diff > 0) || (dir == -1 && diff < 0) {
+						cmp = 1
+					} else {
+						cmp = -1
 					}
 				}
 			}
 		}
-
-		rows = append(rows, compareRow{
-			Field:   label,
-			Base:    baseStr,
-			Next:    nextStr,
-			AbsDiff: absDiff,
-			PctDiff: pctDiff,
-			Cmp:     cmp,
-		})
 	}
 
-	return rows
+	return compareRow{
+		Field:   label,
+		Base:    baseStr,
+		Next:    nextStr,
+		AbsDiff: absDiff,
+		PctDiff: pctDiff,
+		Cmp:     cmp,
+	}
 }
 
 func printCompareTable(rows []compareRow) {
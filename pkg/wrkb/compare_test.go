@@ -0,0 +1,86 @@
+package wrkb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildCompareRows_Percentiles(t *testing.T) {
+	// A file written before the percentiles were configurable.
+	path := filepath.Join(t.TempDir(), "best.json")
+	legacy := `{"url":"http://a/","rps":100,"latency":900,"p50":800,"p90":1200,"p99":2000,"p999":3000,"max":5000,
+		"corrected_p99":2500}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	base, err := readBestResultJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := resultJSON{URL: "http://a/", RPS: 110, Latency: 800, Max: 4000,
+		Percentiles: map[string]int64{"p50": 700, "p75": 900, "p99": 2200, "p99.99": 3900}}
+	rows := map[string]compareRow{}
+	var order []string
+	for _, row := range buildCompareRows(base, next) {
+		rows[row.Field] = row
+		order = append(order, row.Field)
+	}
+
+	if r := rows["p50"]; r.Base != "800.0µs" || r.Next != "700.0µs" || r.PctDiff != "-12.50%" || r.Cmp != 1 {
+		t.Errorf("unexpected p50 row %+v", r)
+	}
+	if r := rows["p99"]; r.Cmp != -1 {
+		t.Errorf("expected a worse p99, got %+v", r)
+	}
+	if r := rows["p90"]; r.Base != "1.2ms" || r.Next != "" || r.AbsDiff != "" {
+		t.Errorf("expected p90 only in base, got %+v", r)
+	}
+	if r := rows["p99.99"]; r.Base != "" || r.Next != "3.9ms" {
+		t.Errorf("expected p99.99 only in next, got %+v", r)
+	}
+	if r := rows["corrected_p99"]; r.Base != "2.5ms" || r.Next != "" {
+		t.Errorf("expected the legacy corrected p99, got %+v", r)
+	}
+
+	want := []string{"p50", "p75", "p90", "p99", "p99.9", "p99.99", "max"}
+	var got []string
+	for _, f := range order {
+		for _, w := range want {
+			if f == w {
+				got = append(got, f)
+			}
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got rows %v, want %v in order", order, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got rows %v, want %v in order", got, want)
+		}
+	}
+}
+
+func TestBuildCompareRows_StatusCodes(t *testing.T) {
+	base := resultJSON{StatusCodes: map[string]int{"200": 90, "503": 10}}
+	next := resultJSON{StatusCodes: map[string]int{"200": 95, "429": 5}, Redirect: 3}
+
+	rows := map[string]compareRow{}
+	for _, row := range buildCompareRows(base, next) {
+		rows[row.Field] = row
+	}
+	if r := rows["status_200"]; r.Base != "90" || r.Next != "95" || r.AbsDiff != "5" || r.PctDiff != "+5.56%" {
+		t.Errorf("unexpected status_200 row %+v", r)
+	}
+	if r := rows["status_429"]; r.Base != "" || r.Next != "5" {
+		t.Errorf("expected status_429 only in next, got %+v", r)
+	}
+	if r := rows["status_503"]; r.Base != "10" || r.Next != "" {
+		t.Errorf("expected status_503 only in base, got %+v", r)
+	}
+	if r := rows["redirect"]; r.Base != "0" || r.Next != "3" {
+		t.Errorf("unexpected redirect row %+v", r)
+	}
+}
@@ -0,0 +1,88 @@
+package wrkb
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// connTracker counts TCP connections dialed for a run, requests sent over an
+// already open connection, the connections the server closed (EOF or reset
+// seen on read, or Connection: close) and TLS handshake latencies.
+type connTracker struct {
+	opened int64
+	reused int64
+	closed int64
+
+	mu         sync.Mutex
+	handshakes *hdrhistogram.Histogram
+}
+
+func (t *connTracker) track(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&t.opened, 1)
+	return &trackedConn{Conn: conn, tracker: t}, nil
+}
+
+func (t *connTracker) peerClosed() {
+	atomic.AddInt64(&t.closed, 1)
+}
+
+func (t *connTracker) reusedConn() {
+	atomic.AddInt64(&t.reused, 1)
+}
+
+func (t *connTracker) recordHandshake(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.handshakes == nil {
+		t.handshakes = newHistogram()
+	}
+	t.handshakes.RecordValue(d.Nanoseconds())
+}
+
+// stat returns the counters collected since the previous call.
+func (t *connTracker) stat() BenchStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat := BenchStat{
+		ConnOpenCnt:        int(atomic.SwapInt64(&t.opened, 0)),
+		ConnReuseCnt:       int(atomic.SwapInt64(&t.reused, 0)),
+		ConnCloseCnt:       int(atomic.SwapInt64(&t.closed, 0)),
+		HandshakeHistogram: t.handshakes,
+	}
+	if t.handshakes != nil {
+		stat.HandshakeCnt = int(t.handshakes.TotalCount())
+	}
+	t.handshakes = nil
+	return stat
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)) {
+		c.markPeerClosed()
+	}
+	return n, err
+}
+
+// markPeerClosed counts the connection as closed by the server, once
+// whichever way the close was seen.
+func (c *trackedConn) markPeerClosed() {
+	c.once.Do(c.tracker.peerClosed)
+}
@@ -0,0 +1,311 @@
+package wrkb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CorpusOrder is how workers draw records from a Corpus.
+type CorpusOrder int
+
+const (
+	// CorpusSequential replays the records once, in file order; the run ends
+	// when the corpus does.
+	CorpusSequential CorpusOrder = iota
+	// CorpusRoundRobin replays the records in file order and starts over at
+	// the end.
+	CorpusRoundRobin
+	// CorpusRandom draws records at random from a window of the corpus that
+	// slides through the file, starting over at the end.
+	CorpusRandom
+)
+
+// corpusWindow is the number of records CorpusRandom draws from, which keeps
+// memory bounded for corpora larger than memory.
+const corpusWindow = 4096
+
+func ParseCorpusOrder(s string) (CorpusOrder, error) {
+	switch s {
+	case "", "sequential", "seq":
+		return CorpusSequential, nil
+	case "round-robin", "rr":
+		return CorpusRoundRobin, nil
+	case "random":
+		return CorpusRandom, nil
+	default:
+		return 0, fmt.Errorf("unknown requests order %q (sequential, round-robin, random)", s)
+	}
+}
+
+// Corpus is a JSONL file of recorded requests replayed instead of the request
+// described by BenchParam, one record per line:
+//
+//	{"method": "POST", "url": "/orders", "headers": {"Content-Type": "application/json"}, "body": "{\"id\":1}"}
+//
+// Headers may also be a list of "Name: value" strings. Records are streamed,
+// never loaded as a whole. A file is read from the start by every run; "-"
+// reads stdin once, so consecutive runs continue where the previous one
+// stopped.
+type Corpus struct {
+	path    string
+	baseURL string
+	order   CorpusOrder
+	stdin   *corpusReader
+}
+
+// replayable reports whether every run reads the corpus from the start; a
+// run reading stdin uses up its records.
+func (c *Corpus) replayable() bool {
+	return c.stdin == nil
+}
+
+type corpusRecord struct {
+	Method  string          `json:"method"`
+	URL     string          `json:"url"`
+	Headers json.RawMessage `json:"headers"`
+	Body    string          `json:"body"`
+}
+
+// OpenCorpus checks that path can be read; URLs starting with "/" are
+// resolved against baseURL.
+func OpenCorpus(path, baseURL string, order CorpusOrder) (*Corpus, error) {
+	c := &Corpus{path: path, baseURL: strings.TrimRight(baseURL, "/"), order: order}
+	if path == "-" {
+		if order == CorpusRoundRobin {
+			return nil, errors.New("round-robin needs a requests file, stdin can only be read once")
+		}
+		c.readStdin(os.Stdin)
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return c, f.Close()
+}
+
+// readStdin starts the single reader of in, which outlives the runs: a
+// blocked read cannot be interrupted, so a run only draws the records it
+// parsed and leaves the rest to the next one.
+func (c *Corpus) readStdin(in io.Reader) {
+	records := make(chan Request)
+	c.stdin = &corpusReader{records: records, name: "stdin"}
+	r := &corpusReader{r: bufio.NewReaderSize(in, 64*1024), name: "stdin"}
+	go func() {
+		defer close(records)
+		for {
+			req, ok := r.read(c, false)
+			if !ok {
+				return
+			}
+			records <- req
+		}
+	}()
+}
+
+// stream sends records until the corpus ends or ctx is done; the channel is
+// closed in both cases. The random order is drawn from seed (see newRand).
+func (c *Corpus) stream(ctx context.Context, seed int64) <-chan Request {
+	if c.stdin != nil {
+		// Unbuffered, so records left when a run ends stay in the reader.
+		ch := make(chan Request)
+		go func() {
+			defer close(ch)
+			// A run ending does not wait for its draws to stop; the next
+			// one takes over the window once they have.
+			c.stdin.mu.Lock()
+			defer c.stdin.mu.Unlock()
+			c.stdin.rng = newRand(seed)
+			c.stdin.produce(ctx, c, ch)
+		}()
+		return ch
+	}
+
+	ch := make(chan Request, 256)
+	go func() {
+		defer close(ch)
+		f, err := os.Open(c.path)
+		if err != nil {
+			log.Printf("requests file: %v", err)
+			return
+		}
+		defer f.Close()
+		r := &corpusReader{r: bufio.NewReaderSize(f, 64*1024), f: f, name: c.path, rng: newRand(seed)}
+		r.produce(ctx, c, ch)
+	}()
+	return ch
+}
+
+type corpusReader struct {
+	r       *bufio.Reader
+	f       *os.File       // nil for stdin, which cannot start over
+	records <-chan Request // the stdin reader's records, instead of r
+	mu      sync.Mutex     // held by the run drawing from records
+	name    string
+	line    int
+	valid   int // records parsed in the current pass
+	pass    int
+
+	window  []Request
+	pending *Request
+	rng     *rand.Rand
+}
+
+func (r *corpusReader) produce(ctx context.Context, c *Corpus, ch chan<- Request) {
+	for {
+		if r.pending == nil {
+			req, ok := r.next(ctx, c)
+			if !ok {
+				return
+			}
+			r.pending = &req
+		}
+
+		select {
+		case ch <- *r.pending:
+			r.pending = nil
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// next returns the next record to send in the corpus order.
+func (r *corpusReader) next(ctx context.Context, c *Corpus) (Request, bool) {
+	if c.order != CorpusRandom {
+		return r.record(ctx, c, c.order == CorpusRoundRobin)
+	}
+
+	for len(r.window) < corpusWindow {
+		req, ok := r.record(ctx, c, r.f != nil)
+		if !ok {
+			break
+		}
+		r.window = append(r.window, req)
+	}
+	if len(r.window) == 0 {
+		return Request{}, false
+	}
+
+	i := r.rng.Intn(len(r.window))
+	req := r.window[i]
+	last := len(r.window) - 1
+	r.window[i] = r.window[last]
+	r.window = r.window[:last]
+	return req, true
+}
+
+// record returns the next record in file order, from the stdin reader when
+// there is one; it gives up when ctx is done.
+func (r *corpusReader) record(ctx context.Context, c *Corpus, rewind bool) (Request, bool) {
+	if r.records == nil {
+		return r.read(c, rewind)
+	}
+	select {
+	case req, ok := <-r.records:
+		return req, ok
+	case <-ctx.Done():
+		return Request{}, false
+	}
+}
+
+// read parses the next valid record. Invalid lines are logged on the first
+// pass and skipped.
+func (r *corpusReader) read(c *Corpus, rewind bool) (Request, bool) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) > 0 {
+			r.line++
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				req, perr := c.parse(line)
+				if perr == nil {
+					r.valid++
+					return req, true
+				}
+				if r.pass == 0 {
+					log.Printf("%s:%d: %v", r.name, r.line, perr)
+				}
+			}
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case err != io.EOF:
+			log.Printf("%s: %v", r.name, err)
+			return Request{}, false
+		case !rewind || r.f == nil || r.valid == 0:
+			return Request{}, false
+		}
+
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			log.Printf("%s: %v", r.name, err)
+			return Request{}, false
+		}
+		r.r.Reset(r.f)
+		r.line, r.valid = 0, 0
+		r.pass++
+	}
+}
+
+func (c *Corpus) parse(line []byte) (Request, error) {
+	var rec corpusRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return Request{}, err
+	}
+	if rec.URL == "" {
+		return Request{}, errors.New("missing url")
+	}
+
+	req := Request{Method: strings.ToUpper(rec.Method), URL: rec.URL, Body: rec.Body}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if strings.HasPrefix(req.URL, "/") {
+		if c.baseURL == "" {
+			return Request{}, fmt.Errorf("relative url %s needs a base URL argument", req.URL)
+		}
+		req.URL = c.baseURL + req.URL
+	}
+
+	headers, err := parseCorpusHeaders(rec.Headers)
+	if err != nil {
+		return Request{}, err
+	}
+	req.Headers = headers
+	return req, nil
+}
+
+func parseCorpusHeaders(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, errors.New("headers must be a list of \"Name: value\" or an object")
+	}
+	headers := make([]string, 0, len(m))
+	for k, v := range m {
+		headers = append(headers, k+": "+v)
+	}
+	sort.Strings(headers)
+	return headers, nil
+}
@@ -0,0 +1,118 @@
+package wrkb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCorpus(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func collectCorpus(t *testing.T, c *Corpus, limit int) []Request {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reqs []Request
+	for req := range c.stream(ctx, 1) {
+		reqs = append(reqs, req)
+		if len(reqs) == limit {
+			break
+		}
+	}
+	return reqs
+}
+
+func TestCorpus_Sequential(t *testing.T) {
+	path := writeCorpus(t,
+		`{"url": "/a"}`,
+		``,
+		`not json`,
+		`{"method": "post", "url": "http://other/b", "headers": {"X-B": "2", "X-A": "1"}, "body": "hi"}`,
+		`{"url": "/c", "headers": ["Accept: */*"]}`,
+	)
+	c, err := OpenCorpus(path, "http://host:8080/", CorpusSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := collectCorpus(t, c, 10)
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 valid records, got %d: %+v", len(reqs), reqs)
+	}
+	if reqs[0].Method != "GET" || reqs[0].URL != "http://host:8080/a" {
+		t.Fatalf("unexpected first record: %+v", reqs[0])
+	}
+	b := reqs[1]
+	if b.Method != "POST" || b.URL != "http://other/b" || b.Body != "hi" ||
+		len(b.Headers) != 2 || b.Headers[0] != "X-A: 1" || b.Headers[1] != "X-B: 2" {
+		t.Fatalf("unexpected second record: %+v", b)
+	}
+	if reqs[2].Headers[0] != "Accept: */*" {
+		t.Fatalf("unexpected headers: %v", reqs[2].Headers)
+	}
+
+	if again := collectCorpus(t, c, 10); len(again) != 3 || again[0].URL != reqs[0].URL {
+		t.Fatalf("expected every run to start from the beginning, got %+v", again)
+	}
+}
+
+func TestCorpus_RoundRobin(t *testing.T) {
+	c, err := OpenCorpus(writeCorpus(t, `{"url": "http://h/1"}`, `{"url": "http://h/2"}`), "", CorpusRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := collectCorpus(t, c, 5)
+	for i, want := range []string{"1", "2", "1", "2", "1"} {
+		if reqs[i].URL != "http://h/"+want {
+			t.Fatalf("record %d: got %s, want http://h/%s", i, reqs[i].URL, want)
+		}
+	}
+}
+
+func TestCorpus_Random(t *testing.T) {
+	c, err := OpenCorpus(writeCorpus(t, `{"url": "http://h/1"}`, `{"url": "http://h/2"}`, `{"url": "http://h/3"}`), "", CorpusRandom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for _, req := range collectCorpus(t, c, 3000) {
+		counts[req.URL]++
+	}
+	for _, u := range []string{"http://h/1", "http://h/2", "http://h/3"} {
+		if counts[u] < 800 || counts[u] > 1200 {
+			t.Fatalf("expected about 1000 draws of %s, got %v", u, counts)
+		}
+	}
+}
+
+func TestCorpus_Errors(t *testing.T) {
+	if _, err := OpenCorpus(filepath.Join(t.TempDir(), "missing.jsonl"), "", CorpusSequential); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+	if _, err := OpenCorpus("-", "", CorpusRoundRobin); err == nil {
+		t.Errorf("expected error for round-robin over stdin")
+	}
+	if _, err := ParseCorpusOrder("shuffle"); err == nil {
+		t.Errorf("expected error for an unknown order")
+	}
+
+	c, err := OpenCorpus(writeCorpus(t, `{"url": "/relative"}`, `{"method": "GET"}`), "", CorpusRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reqs := collectCorpus(t, c, 10); len(reqs) != 0 {
+		t.Fatalf("expected no valid records, got %+v", reqs)
+	}
+}
@@ -0,0 +1,138 @@
+package wrkb
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// csvColumn is a column of the --csv export. Unlike the terminal table, the
+// columns do not depend on the run, so that rows of different runs appended
+// to one file line up.
+type csvColumn struct {
+	title string
+	value func(r BenchResult) string
+}
+
+func csvColumns(percentiles []float64) []csvColumn {
+	itoa := strconv.Itoa
+	micros := func(d time.Duration) string { return strconv.FormatInt(d.Microseconds(), 10) }
+
+	cols := []csvColumn{
+		{"proc_name", func(r BenchResult) string { return r.Param.ProcName }},
+		{"method", func(r BenchResult) string { return r.Param.Method }},
+		{"url", func(r BenchResult) string { return r.Param.URL }},
+		{"stage", func(r BenchResult) string {
+			switch {
+			case r.Stage > 0:
+				return itoa(r.Stage)
+			case len(r.Param.Stages) > 0:
+				return "total"
+			}
+			return ""
+		}},
+		{"conn", func(r BenchResult) string { return itoa(r.Param.ConnNum) }},
+		{"rps", func(r BenchResult) string { return itoa(r.RPS) }},
+		{"latency", func(r BenchResult) string { return micros(r.Latency) }},
+		{"min", func(r BenchResult) string { return micros(r.Min) }},
+	}
+	for _, p := range percentiles {
+		cols = append(cols, csvColumn{percentileLabel(p), func(r BenchResult) string { return micros(r.Percentile(p)) }})
+	}
+	cols = append(cols, []csvColumn{
+		{"max", func(r BenchResult) string { return micros(r.Max) }},
+		{"good", func(r BenchResult) string { return itoa(r.Stat.GoodCnt) }},
+		{"redirect", func(r BenchResult) string { return itoa(r.Stat.RedirectCnt) }},
+		{"bad", func(r BenchResult) string { return itoa(r.Stat.BadCnt) }},
+		{"failed", func(r BenchResult) string { return itoa(r.Stat.FailedCnt) }},
+		{"err", func(r BenchResult) string { return itoa(r.Stat.ErrorCnt) }},
+	}...)
+	for k := ErrorKind(0); k < errorKindCount; k++ {
+		cols = append(cols, csvColumn{k.String(), func(r BenchResult) string { return itoa(r.Stat.ErrorKindCnt[k]) }})
+	}
+	return append(cols, []csvColumn{
+		{"missed", func(r BenchResult) string { return itoa(r.Stat.MissedCnt) }},
+		{"cor_p99", func(r BenchResult) string { return micros(correctedP99(r)) }},
+		{"open", func(r BenchResult) string { return itoa(r.Stat.ConnOpenCnt) }},
+		{"reuse", func(r BenchResult) string { return itoa(r.Stat.ConnReuseCnt) }},
+		{"srv_cls", func(r BenchResult) string { return itoa(r.Stat.ConnCloseCnt) }},
+		{"tls_hs", func(r BenchResult) string { return itoa(r.Stat.HandshakeCnt) }},
+		{"hs_lat", func(r BenchResult) string { return micros(r.Handshake.Latency) }},
+		{"streams", func(r BenchResult) string { return itoa(r.Stat.StreamCnt) }},
+		{"body_req", func(r BenchResult) string { return itoa(r.Stat.BodyReqSize) }},
+		{"body_resp", func(r BenchResult) string { return itoa(r.Stat.BodyRespSize) }},
+		{"cpu", func(r BenchResult) string { return strconv.FormatFloat(r.CPU, 'f', 2, 64) }},
+		{"thr", func(r BenchResult) string { return itoa(r.Threads) }},
+		{"mem", func(r BenchResult) string { return strconv.FormatInt(r.MemRSS, 10) }},
+		{"duration", func(r BenchResult) string { return micros(r.Param.Duration) }},
+		{"elapsed", func(r BenchResult) string { return micros(r.Elapsed) }},
+		{"seed", func(r BenchResult) string { return strconv.FormatInt(r.Param.Seed, 10) }},
+		{"best", func(r BenchResult) string { return strconv.FormatBool(r.Best) }},
+	}...)
+}
+
+// csvRunLayout is RFC3339 with milliseconds, which tells apart runs started
+// in the same second.
+const csvRunLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// writeResultsCSV appends a row per result, and per stage before the total of
+// a staged result, to path. Every row starts with run, the start of the
+// sweep, which with proc_name, method and url tells appended runs apart. The
+// header is written to a new file; an existing file must have the same one,
+// so the same percentiles.
+func writeResultsCSV(path string, run time.Time, percentiles []float64, results []BenchResult) error {
+	cols := csvColumns(percentiles)
+	header := []string{"run"}
+	for _, c := range cols {
+		header = append(header, c.title)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	existing, err := csv.NewReader(f).Read()
+	switch {
+	case errors.Is(err, io.EOF):
+		if err := w.Write(header); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("%s: %w", path, err)
+	case !slices.Equal(existing, header):
+		return fmt.Errorf("%s: has different columns, write the results to another file", path)
+	}
+
+	runID := run.Format(csvRunLayout)
+	row := func(r BenchResult) error {
+		record := []string{runID}
+		for _, c := range cols {
+			record = append(record, c.value(r))
+		}
+		return w.Write(record)
+	}
+	for _, r := range results {
+		for _, stage := range r.Stages {
+			if err := row(stage); err != nil {
+				return err
+			}
+		}
+		if err := row(r); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package wrkb
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteResultsCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sweep.csv")
+	staged := BenchParam{ProcName: "api", URL: "http://b/", Stages: []Stage{{Duration: time.Second}}}
+	stage := staged
+	stage.Stages = nil
+	results := []BenchResult{
+		{Param: BenchParam{ProcName: "api", Method: "GET", URL: "http://a/", ConnNum: 4}, RPS: 100, Best: true,
+			LatencyStat: LatencyStat{Percentiles: []PercentileValue{{99, 1500 * time.Microsecond}}}},
+		{Param: staged, RPS: 50, Stages: []BenchResult{{Param: stage, RPS: 50, Stage: 1}}},
+	}
+
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := writeResultsCSV(path, first, DefaultPercentiles, results); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResultsCSV(path, first.Add(time.Minute), DefaultPercentiles, results[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected a header and 4 rows, got %d", len(rows))
+	}
+	col := func(row []string, name string) string {
+		for i, title := range rows[0] {
+			if title == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+
+	want := []struct{ run, url, stage, rps, best string }{
+		{"2026-01-02T03:04:05.000Z", "http://a/", "", "100", "true"},
+		{"2026-01-02T03:04:05.000Z", "http://b/", "1", "50", "false"},
+		{"2026-01-02T03:04:05.000Z", "http://b/", "total", "50", "false"},
+		{"2026-01-02T03:05:05.000Z", "http://a/", "", "100", "true"},
+	}
+	for i, w := range want {
+		row := rows[i+1]
+		got := []string{col(row, "run"), col(row, "url"), col(row, "stage"), col(row, "rps"), col(row, "best")}
+		if strings.Join(got, ",") != strings.Join([]string{w.run, w.url, w.stage, w.rps, w.best}, ",") {
+			t.Errorf("row %d: got %v, want %+v", i+1, got, w)
+		}
+	}
+	if p99 := col(rows[1], "p99"); p99 != "1500" {
+		t.Errorf("expected p99 in µs, got %s", p99)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.csv")
+	if err := os.WriteFile(other, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResultsCSV(other, first, DefaultPercentiles, results); err == nil {
+		t.Error("expected an error for a file with different columns")
+	}
+}
@@ -0,0 +1,333 @@
+package wrkb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CurlRequest is the request described by a curl command line.
+type CurlRequest struct {
+	Method   string
+	URL      string
+	Headers  []string
+	Body     string
+	Insecure bool
+}
+
+// curlOptions maps the supported curl options to whether they take a value.
+var curlOptions = map[string]bool{
+	"-X":            true,
+	"--request":     true,
+	"-H":            true,
+	"--header":      true,
+	"-d":            true,
+	"--data":        true,
+	"--data-ascii":  true,
+	"--data-raw":    true,
+	"--data-binary": true,
+	"--json":        true,
+	"-u":            true,
+	"--user":        true,
+	"-b":            true,
+	"--cookie":      true,
+	"-A":            true,
+	"--user-agent":  true,
+	"-e":            true,
+	"--referer":     true,
+	"--url":         true,
+	"-I":            false,
+	"--head":        false,
+	"-k":            false,
+	"--insecure":    false,
+	"--compressed":  false,
+	// Output only, the request is the same with or without them.
+	"-s":                  false,
+	"--silent":            false,
+	"-S":                  false,
+	"--show-error":        false,
+	"--no-progress-meter": false,
+}
+
+// ParseCurl parses a curl command line, as copied with "Copy as cURL" from a
+// browser, into a request. It covers -X, -H, -d/--data-raw/--data-binary,
+// --json, -u, -b, -A, -e, -I, --compressed, -k and the URL; any other option
+// is an error, since ignoring it would benchmark a different request.
+func ParseCurl(command string) (CurlRequest, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return CurlRequest{}, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	var (
+		req        CurlRequest
+		data       []string
+		head       bool
+		compressed bool
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" || arg[0] != '-' || arg == "-" {
+			if req.URL != "" {
+				return CurlRequest{}, fmt.Errorf("curl: more than one URL (%s, %s)", req.URL, arg)
+			}
+			req.URL = arg
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue = strings.Cut(arg, "=")
+		case len(arg) > 2:
+			// -XPOST, -sSk
+			name = arg[:2]
+			if curlOptions[name] {
+				value, hasValue = arg[2:], true
+			} else if flags, err := splitShortFlags(arg); err != nil {
+				return CurlRequest{}, err
+			} else {
+				args = append(append(args[:i+1:i+1], flags...), args[i+1:]...)
+				continue
+			}
+		}
+
+		takesValue, ok := curlOptions[name]
+		if !ok {
+			return CurlRequest{}, fmt.Errorf("curl: unsupported option %s", name)
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return CurlRequest{}, fmt.Errorf("curl: option %s needs a value", name)
+			}
+			i++
+			value = args[i]
+		} else if !takesValue && hasValue {
+			return CurlRequest{}, fmt.Errorf("curl: option %s takes no value", name)
+		}
+
+		switch name {
+		case "-X", "--request":
+			req.Method = strings.ToUpper(value)
+		case "-H", "--header":
+			if !strings.Contains(value, ":") {
+				return CurlRequest{}, fmt.Errorf("curl: invalid header %q", value)
+			}
+			req.Headers = append(req.Headers, value)
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(value, "@") {
+				return CurlRequest{}, fmt.Errorf("curl: %s %s: reading data from a file is not supported", name, value)
+			}
+			data = append(data, value)
+		case "--data-raw":
+			data = append(data, value)
+		case "--json":
+			data = append(data, value)
+			req.Headers = appendMissingHeader(req.Headers, "Content-Type", "application/json")
+			req.Headers = appendMissingHeader(req.Headers, "Accept", "application/json")
+		case "-u", "--user":
+			if !strings.Contains(value, ":") {
+				return CurlRequest{}, fmt.Errorf("curl: %s %s: password must be given as user:password", name, value)
+			}
+			req.Headers = append(req.Headers, "Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "-b", "--cookie":
+			if !strings.Contains(value, "=") {
+				return CurlRequest{}, fmt.Errorf("curl: %s %s: reading cookies from a file is not supported", name, value)
+			}
+			req.Headers = append(req.Headers, "Cookie: "+value)
+		case "-A", "--user-agent":
+			req.Headers = append(req.Headers, "User-Agent: "+value)
+		case "-e", "--referer":
+			req.Headers = append(req.Headers, "Referer: "+value)
+		case "--url":
+			if req.URL != "" {
+				return CurlRequest{}, fmt.Errorf("curl: more than one URL (%s, %s)", req.URL, value)
+			}
+			req.URL = value
+		case "-I", "--head":
+			head = true
+		case "-k", "--insecure":
+			req.Insecure = true
+		case "--compressed":
+			compressed = true
+		}
+	}
+
+	if req.URL == "" {
+		return CurlRequest{}, errors.New("curl: no URL")
+	}
+	if !strings.Contains(req.URL, "://") {
+		req.URL = "http://" + req.URL
+	}
+
+	if len(data) > 0 {
+		if head {
+			return CurlRequest{}, errors.New("curl: -I cannot be combined with a request body")
+		}
+		req.Body = strings.Join(data, "&")
+		req.Headers = appendMissingHeader(req.Headers, "Content-Type", "application/x-www-form-urlencoded")
+	}
+	if compressed {
+		req.Headers = appendMissingHeader(req.Headers, "Accept-Encoding", "deflate, gzip, br, zstd")
+	}
+	if req.Method == "" {
+		switch {
+		case head:
+			req.Method = "HEAD"
+		case len(data) > 0:
+			req.Method = "POST"
+		default:
+			req.Method = "GET"
+		}
+	}
+	return req, nil
+}
+
+// splitShortFlags expands bundled short options such as -sSk; all of them
+// must take no value, except the last one.
+func splitShortFlags(arg string) ([]string, error) {
+	var flags []string
+	for i := 1; i < len(arg); i++ {
+		name := "-" + arg[i:i+1]
+		takesValue, ok := curlOptions[name]
+		if !ok {
+			return nil, fmt.Errorf("curl: unsupported option %s", name)
+		}
+		if takesValue {
+			return append(flags, name+arg[i+1:]), nil
+		}
+		flags = append(flags, name)
+	}
+	return flags, nil
+}
+
+func appendMissingHeader(headers []string, name, value string) []string {
+	if hasHeader(headers, name) {
+		return headers
+	}
+	return append(headers, name+": "+value)
+}
+
+// splitShellWords splits a POSIX shell command line into words, handling
+// single, double and $'…' quotes and backslash line continuations.
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("curl: trailing backslash")
+			}
+			i++
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("curl: unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := readANSIQuoted(s[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("curl: unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// readANSIQuoted decodes the body of a $'…' string up to and including the
+// closing quote and returns the number of bytes consumed.
+func readANSIQuoted(s string, word *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return 0, errors.New("curl: unterminated $' quote")
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				word.WriteByte('\n')
+			case 't':
+				word.WriteByte('\t')
+			case 'r':
+				word.WriteByte('\r')
+			case 'x', 'u', 'U':
+				digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				j := i + 1
+				for j < len(s) && j < i+1+digits && isHexDigit(s[j]) {
+					j++
+				}
+				if j == i+1 {
+					return 0, fmt.Errorf("curl: invalid escape \\%c", e)
+				}
+				v, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+				if e == 'x' {
+					word.WriteByte(byte(v))
+				} else {
+					word.WriteString(string(rune(v)))
+				}
+				i = j - 1
+			case '\\', '\'', '"', '?':
+				word.WriteByte(e)
+			default:
+				word.WriteByte('\\')
+				word.WriteByte(e)
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	return 0, errors.New("curl: unterminated $' quote")
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,105 @@
+package wrkb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    CurlRequest
+	}{
+		{
+			name:    "get",
+			command: `curl http://127.0.0.1:8082/items`,
+			want:    CurlRequest{Method: "GET", URL: "http://127.0.0.1:8082/items"},
+		},
+		{
+			name: "browser copy",
+			command: `curl 'https://api.example.com/orders?x=1' \
+  -H 'accept: application/json' \
+  -H 'content-type: application/json' \
+  -b 'sid=abc; theme=dark' \
+  --data-raw $'{"note":"it\'s\n"}' \
+  --compressed`,
+			want: CurlRequest{
+				Method: "POST",
+				URL:    "https://api.example.com/orders?x=1",
+				Headers: []string{
+					"accept: application/json",
+					"content-type: application/json",
+					"Cookie: sid=abc; theme=dark",
+					"Accept-Encoding: deflate, gzip, br, zstd",
+				},
+				Body: "{\"note\":\"it's\n\"}",
+			},
+		},
+		{
+			name:    "form data and auth",
+			command: `curl -sSk -XPUT -u user:pass -d a=1 --data "b=2" --url localhost:8080/form`,
+			want: CurlRequest{
+				Method:   "PUT",
+				URL:      "http://localhost:8080/form",
+				Headers:  []string{"Authorization: Basic dXNlcjpwYXNz", "Content-Type: application/x-www-form-urlencoded"},
+				Body:     "a=1&b=2",
+				Insecure: true,
+			},
+		},
+		{
+			name:    "json and head",
+			command: `curl --json '{"a":1}' --request=PATCH -A wrkb -e "http://ref/\"x\"" http://h/`,
+			want: CurlRequest{
+				Method:  "PATCH",
+				URL:     "http://h/",
+				Headers: []string{"Content-Type: application/json", "Accept: application/json", "User-Agent: wrkb", "Referer: http://ref/\"x\""},
+				Body:    `{"a":1}`,
+			},
+		},
+		{
+			name:    "head",
+			command: `curl -I http://h/`,
+			want:    CurlRequest{Method: "HEAD", URL: "http://h/"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseCurl(tt.command)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Method != tt.want.Method || got.URL != tt.want.URL || got.Body != tt.want.Body || got.Insecure != tt.want.Insecure ||
+			strings.Join(got.Headers, "|") != strings.Join(tt.want.Headers, "|") {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCurl_Errors(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{`curl -L http://h/`, "unsupported option -L"},
+		{`curl --location http://h/`, "unsupported option --location"},
+		{`curl -sL http://h/`, "unsupported option -L"},
+		{`curl -F a=1 http://h/`, "unsupported option -F"},
+		{`curl -d @body.json http://h/`, "reading data from a file"},
+		{`curl -u user http://h/`, "user:password"},
+		{`curl -b cookies.txt http://h/`, "reading cookies from a file"},
+		{`curl -H`, "needs a value"},
+		{`curl -H nocolon http://h/`, "invalid header"},
+		{`curl --insecure=yes http://h/`, "takes no value"},
+		{`curl http://a/ http://b/`, "more than one URL"},
+		{`curl -k`, "no URL"},
+		{`curl 'http://h/`, "unterminated single quote"},
+		{`curl -I -d a=1 http://h/`, "-I cannot be combined"},
+	}
+	for _, tt := range tests {
+		_, err := ParseCurl(tt.command)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.command, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package wrkb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ErrorKind is the transport error category a failed request is counted in.
+type ErrorKind int
+
+const (
+	ErrKindTimeout ErrorKind = iota
+	ErrKindRefused
+	ErrKindReset
+	ErrKindDNS
+	ErrKindTLS
+	ErrKindOther
+	errorKindCount
+)
+
+var errorKindNames = [errorKindCount]string{"timeout", "refused", "reset", "dns", "tls", "other"}
+
+func (k ErrorKind) String() string {
+	if k < 0 || k >= errorKindCount {
+		return "unknown"
+	}
+	return errorKindNames[k]
+}
+
+// handshakeError marks failures of the TLS handshake done by connTracker.
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string { return "tls handshake: " + e.err.Error() }
+
+func (e *handshakeError) Unwrap() error { return e.err }
+
+func classifyError(err error) ErrorKind {
+	var hsErr *handshakeError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrKindDNS
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		errors.As(err, &hsErr), errors.Is(err, fasthttp.ErrTLSHandshakeTimeout):
+		return ErrKindTLS
+	case errors.Is(err, fasthttp.ErrTimeout), errors.Is(err, fasthttp.ErrDialTimeout),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrKindTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrKindRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, fasthttp.ErrConnectionClosed), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrKindReset
+	default:
+		return ErrKindOther
+	}
+}
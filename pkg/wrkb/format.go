@@ -2,6 +2,7 @@ package wrkb
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -20,3 +21,15 @@ func formatDuration1(d time.Duration) string {
 		return fmt.Sprintf("%.1fns", float64(d))
 	}
 }
+
+// formatLatencyLines formats min, the percentiles and max one per line, as in
+// the best result footer.
+func formatLatencyLines(s LatencyStat) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "min=%-8s \n", formatDuration1(s.Min))
+	for _, p := range s.Percentiles {
+		fmt.Fprintf(&b, "%s=%-8s \n", percentileLabel(p.Percentile), formatDuration1(p.Value))
+	}
+	fmt.Fprintf(&b, "max=%-8s\n", formatDuration1(s.Max))
+	return b.String()
+}
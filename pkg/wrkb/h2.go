@@ -0,0 +1,203 @@
+package wrkb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// h2Transport multiplexes workers over HTTP/2 connections. Every transport
+// keeps a single connection to the target, so workers sharing a transport
+// share a connection and run as concurrent streams on it.
+type h2Transport struct {
+	param      BenchParam
+	transports []*http.Transport
+	tlsConfig  *tls.Config
+	tracker    connTracker
+	streams    int64
+}
+
+func newH2Transport(param BenchParam) *h2Transport {
+	streams := max(param.StreamsPerConn, 1)
+	t := &h2Transport{param: param, tlsConfig: clientTLSConfig(param.TLSConfig, "h2")}
+	connNum := (param.ConnNum + streams - 1) / streams
+	for i := 0; i < connNum; i++ {
+		t.transports = append(t.transports, t.newTransport())
+	}
+	return t
+}
+
+func (t *h2Transport) newTransport() *http.Transport {
+	protocols := new(http.Protocols)
+	if t.param.H2C {
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		protocols.SetHTTP2(true)
+	}
+
+	dialer := &net.Dialer{Timeout: t.param.connectTimeout()}
+	return &http.Transport{
+		Protocols:             protocols,
+		ForceAttemptHTTP2:     true,
+		MaxConnsPerHost:       1,
+		MaxIdleConnsPerHost:   1,
+		IdleConnTimeout:       1 * time.Minute,
+		ResponseHeaderTimeout: t.param.readTimeout(),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return t.tracker.track(dialer.DialContext(ctx, network, addr))
+		},
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := t.tracker.track(dialer.DialContext(ctx, network, addr))
+			if err != nil {
+				return nil, err
+			}
+			return t.tracker.handshake(conn, t.tlsConfig, addr, dialer.Timeout)
+		},
+	}
+}
+
+func (t *h2Transport) Requester(worker int) Requester {
+	streams := max(t.param.StreamsPerConn, 1)
+	transport := t.transports[worker/streams]
+	param := t.param
+	decode := param.needsBody()
+	readBody := param.Verbose || decode
+	var decoded []byte
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.tracker.reusedConn()
+			}
+		},
+	}
+
+	var respHeader http.Header
+	header := func(name string) (string, bool) {
+		vs := respHeader.Values(name)
+		if len(vs) == 0 {
+			return "", false
+		}
+		return vs[0], true
+	}
+
+	return RequesterFunc(func(_ context.Context, r *Request) Outcome {
+		var out Outcome
+
+		var body io.Reader
+		if r.Body != "" {
+			body = strings.NewReader(r.Body)
+			out.ReqBytes = len(r.Body)
+		}
+
+		reqCtx := httptrace.WithClientTrace(context.Background(), trace)
+		if param.Timeout > 0 {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithTimeout(reqCtx, param.Timeout)
+			defer cancel()
+		}
+
+		req, err := http.NewRequestWithContext(reqCtx, r.Method, r.URL, body)
+		if err != nil {
+			out.Err = err
+			return out
+		}
+		for _, h := range r.Headers {
+			parts := strings.SplitN(h, ":", 2)
+			if len(parts) == 2 {
+				req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			}
+		}
+		if body != nil && !hasHeader(r.Headers, "Content-Type") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		logH2Request(req, param.Verbose)
+
+		out.Start = time.Now()
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			out.End = time.Now()
+			out.Err = err
+			return out
+		}
+
+		var respBody []byte
+		if readBody {
+			respBody, err = io.ReadAll(resp.Body)
+			out.RespBytes = len(respBody)
+		} else {
+			var n int64
+			n, err = io.Copy(io.Discard, resp.Body)
+			out.RespBytes = int(n)
+		}
+		resp.Body.Close()
+		out.End = time.Now()
+
+		if err != nil {
+			out.Err = err
+			return out
+		}
+
+		logH2Response(resp, respBody, param.Verbose, out.End.Sub(out.Start))
+		out.Status = resp.StatusCode
+		out.Body = respBody
+		respHeader = resp.Header
+		out.Header = header
+		if enc := resp.Header.Get("Content-Encoding"); decode && enc != "" {
+			decoded, out.Err = decodeBody(decoded[:0], enc, respBody)
+			out.Body = decoded
+		}
+		if resp.ProtoMajor == 2 {
+			atomic.AddInt64(&t.streams, 1)
+		}
+		return out
+	})
+}
+
+func (t *h2Transport) Stat() BenchStat {
+	stat := t.tracker.stat()
+	stat.StreamCnt = int(atomic.SwapInt64(&t.streams, 0))
+	return stat
+}
+
+func (t *h2Transport) Close() {
+	for _, tr := range t.transports {
+		tr.CloseIdleConnections()
+	}
+}
+
+func logH2Request(req *http.Request, isVerbose bool) {
+	if isVerbose {
+		fmt.Printf("> %s %s %s\n", req.Method, req.URL.RequestURI(), "HTTP/2.0")
+		fmt.Printf("> Host: %s\n", req.URL.Host)
+		for k, vs := range req.Header {
+			for _, v := range vs {
+				fmt.Printf("> %s: %s\n", k, v)
+			}
+		}
+		fmt.Printf("> \n* Request completely sent off\n")
+	}
+}
+
+func logH2Response(resp *http.Response, body []byte, isVerbose bool, elapsedReq time.Duration) {
+	if isVerbose {
+		fmt.Printf("< %s %s\n", resp.Proto, resp.Status)
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				fmt.Printf("< %s: %s\n", k, v)
+			}
+		}
+		fmt.Printf("< \n")
+		if len(body) > 0 {
+			fmt.Println(string(body))
+		}
+		fmt.Printf("* Stream closed | time: %v | bodyRespSize: %d bytes\n\n", elapsedReq, len(body))
+	}
+}
@@ -0,0 +1,211 @@
+package wrkb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HAROptions selects and rewrites the entries ImportHAR turns into templates.
+type HAROptions struct {
+	// Host and Path keep only the entries whose host or path match.
+	Host *regexp.Regexp
+	Path *regexp.Regexp
+	// Methods keeps only these methods when set.
+	Methods []string
+	// StripCookies drops Cookie headers.
+	StripCookies bool
+	// Replace maps literal values to the placeholders that replace them in
+	// URLs, headers and bodies, e.g. "42" to "__RANDI64_1_1000__".
+	Replace map[string]string
+	// BaseURL replaces the scheme and host of every entry when set.
+	BaseURL string
+	// Sequence imports the entries as the steps of a single sequence in
+	// capture order instead of a weighted mix.
+	Sequence bool
+}
+
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		PostData *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harSkipHeaders are set by the transports themselves, or describe the
+// captured body rather than the replayed one.
+var harSkipHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"keep-alive":        true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// harIDSegment matches path segments that identify a resource rather than an
+// endpoint: numbers, UUIDs and long hex strings.
+var harIDSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// ImportHAR turns the requests of a HAR file into scenario templates. Every
+// template is named after its URL group, "<method> <host><path>" without the
+// query and with ids in the path replaced by {id}, so calls to the same
+// endpoint are reported together.
+func ImportHAR(path string, opts HAROptions) ([]RequestTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file harFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid HAR %s: %w", path, err)
+	}
+
+	replacer := opts.replacer()
+	var templates []RequestTemplate
+	for i, e := range file.Log.Entries {
+		t, ok, err := opts.template(e, replacer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HAR %s: entry %d: %w", path, i+1, err)
+		}
+		if ok {
+			templates = append(templates, t)
+		}
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("HAR %s: no entries left after filtering", path)
+	}
+
+	if opts.Sequence {
+		return []RequestTemplate{{Name: "har", Weight: 1, Steps: templates}}, nil
+	}
+	return templates, nil
+}
+
+func (o *HAROptions) template(e harEntry, replacer *strings.Replacer) (RequestTemplate, bool, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return RequestTemplate{}, false, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return RequestTemplate{}, false, nil
+	}
+
+	method := strings.ToUpper(e.Request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	switch {
+	case o.Host != nil && !o.Host.MatchString(u.Host):
+		return RequestTemplate{}, false, nil
+	case o.Path != nil && !o.Path.MatchString(u.Path):
+		return RequestTemplate{}, false, nil
+	case len(o.Methods) > 0 && !containsFold(o.Methods, method):
+		return RequestTemplate{}, false, nil
+	}
+
+	t := RequestTemplate{Name: method + " " + u.Host + harGroupPath(u.Path), Weight: 1, Method: method}
+	if o.BaseURL != "" {
+		base, err := url.Parse(o.BaseURL)
+		if err != nil {
+			return RequestTemplate{}, false, err
+		}
+		u.Scheme, u.Host = base.Scheme, base.Host
+	}
+	t.URL = replacer.Replace(u.String())
+
+	for _, h := range e.Request.Headers {
+		name := strings.ToLower(h.Name)
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] || (o.StripCookies && name == "cookie") {
+			continue
+		}
+		t.Headers = append(t.Headers, h.Name+": "+replacer.Replace(h.Value))
+	}
+
+	if pd := e.Request.PostData; pd != nil {
+		body := pd.Text
+		if body == "" && len(pd.Params) > 0 {
+			form := url.Values{}
+			for _, p := range pd.Params {
+				form.Add(p.Name, p.Value)
+			}
+			body = form.Encode()
+		}
+		t.Body = replacer.Replace(body)
+		if pd.MimeType != "" && !hasHeader(t.Headers, "Content-Type") {
+			t.Headers = append(t.Headers, "Content-Type: "+pd.MimeType)
+		}
+	}
+	return t, true, nil
+}
+
+// replacer substitutes every Replace value in a single pass over the text,
+// so a placeholder put in for one value is never rewritten by another. Where
+// values overlap the longest one wins.
+func (o *HAROptions) replacer() *strings.Replacer {
+	values := make([]string, 0, len(o.Replace))
+	for v := range o.Replace {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, o.Replace[v])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func harGroupPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if harIDSegment.MatchString(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteScenario writes templates in the format read by LoadScenario.
+func WriteScenario(w io.Writer, templates []RequestTemplate) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(scenarioFile{Requests: templates})
+}
@@ -0,0 +1,112 @@
+package wrkb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testHAR = `{"log": {"entries": [
+	{"request": {"method": "GET", "url": "https://shop.example.com/api/items/42?ref=home",
+		"headers": [{"name": ":authority", "value": "shop.example.com"}, {"name": "Cookie", "value": "sid=1"}, {"name": "Accept", "value": "application/json"}]}},
+	{"request": {"method": "GET", "url": "https://shop.example.com/api/items/43", "headers": []}},
+	{"request": {"method": "POST", "url": "https://shop.example.com/api/orders",
+		"headers": [{"name": "Content-Length", "value": "9"}],
+		"postData": {"mimeType": "application/json", "text": "{\"id\":42}"}}},
+	{"request": {"method": "POST", "url": "https://shop.example.com/login",
+		"headers": [], "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "user", "value": "bob"}]}}},
+	{"request": {"method": "GET", "url": "https://cdn.example.com/app.js", "headers": []}},
+	{"request": {"method": "GET", "url": "data:image/png;base64,AAAA", "headers": []}}
+]}}`
+
+func writeHAR(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := os.WriteFile(path, []byte(testHAR), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportHAR(t *testing.T) {
+	templates, err := ImportHAR(writeHAR(t), HAROptions{
+		Host:         regexp.MustCompile(`^shop\.`),
+		StripCookies: true,
+		Replace:      map[string]string{"42": "__RANDI64_1_100__"},
+		BaseURL:      "http://127.0.0.1:8082",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RequestTemplate{
+		{Name: "GET shop.example.com/api/items/{id}", Method: "GET", URL: "http://127.0.0.1:8082/api/items/__RANDI64_1_100__?ref=home", Headers: []string{"Accept: application/json"}},
+		{Name: "GET shop.example.com/api/items/{id}", Method: "GET", URL: "http://127.0.0.1:8082/api/items/43"},
+		{Name: "POST shop.example.com/api/orders", Method: "POST", URL: "http://127.0.0.1:8082/api/orders", Headers: []string{"Content-Type: application/json"}, Body: `{"id":__RANDI64_1_100__}`},
+		{Name: "POST shop.example.com/login", Method: "POST", URL: "http://127.0.0.1:8082/login", Headers: []string{"Content-Type: application/x-www-form-urlencoded"}, Body: "user=bob"},
+	}
+	if len(templates) != len(want) {
+		t.Fatalf("expected %d templates, got %d: %+v", len(want), len(templates), templates)
+	}
+	for i, w := range want {
+		got := templates[i]
+		if got.Name != w.Name || got.Method != w.Method || got.URL != w.URL || got.Body != w.Body ||
+			strings.Join(got.Headers, "|") != strings.Join(w.Headers, "|") {
+			t.Errorf("template %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestHAROptions_Replace(t *testing.T) {
+	o := HAROptions{Replace: map[string]string{"42": "__RANDI64_1_1000__", "4": "__RANDI64_1_9__", "1": "__UUID4__"}}
+
+	got := o.replacer().Replace("/users/42?page=1&n=4")
+	if want := "/users/__RANDI64_1_1000__?page=__UUID4__&n=__RANDI64_1_9__"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestImportHAR_Filters(t *testing.T) {
+	path := writeHAR(t)
+
+	templates, err := ImportHAR(path, HAROptions{Path: regexp.MustCompile(`^/api/`), Methods: []string{"post"}, Sequence: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || len(templates[0].Steps) != 1 || templates[0].Steps[0].URL != "https://shop.example.com/api/orders" {
+		t.Fatalf("unexpected templates: %+v", templates)
+	}
+
+	if _, err := ImportHAR(path, HAROptions{Host: regexp.MustCompile(`^nowhere$`)}); err == nil {
+		t.Errorf("expected error when no entry is left")
+	}
+	cookies, err := ImportHAR(path, HAROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 5 || strings.Join(cookies[0].Headers, "|") != "Cookie: sid=1|Accept: application/json" {
+		t.Errorf("expected cookies to be kept by default, got %+v", cookies[0].Headers)
+	}
+}
+
+func TestImportHAR_WriteScenario(t *testing.T) {
+	templates, err := ImportHAR(writeHAR(t), HAROptions{Sequence: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteScenario(&buf, templates); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadScenario(writeScenario(t, buf.String()), "")
+	if err != nil {
+		t.Fatalf("written scenario does not load: %v\n%s", err, buf.String())
+	}
+	if len(loaded) != 1 || len(loaded[0].Steps) != 5 || loaded[0].Steps[2].Body != `{"id":42}` {
+		t.Fatalf("unexpected round trip: %+v", loaded)
+	}
+}
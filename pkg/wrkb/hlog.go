@@ -0,0 +1,133 @@
+package wrkb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// namedHistogram is the latency histogram of a level or a stage, named after
+// the connections and the stage: c8, c8-stage2, and c8-corrected for the
+// open-loop one.
+type namedHistogram struct {
+	name       string
+	start, end time.Time
+	hist       *hdrhistogram.Histogram
+}
+
+// resultHistograms lists the histograms of results, the stages of a staged
+// level before its total. Names of repeated levels get a -2, -3, … suffix.
+// With windows, a level or stage sampled with --interval is listed as the
+// histograms of its samples, and staged totals are left out.
+func resultHistograms(results []BenchResult, windows bool) []namedHistogram {
+	var out []namedHistogram
+	var level time.Time
+	add := func(name string, start, end time.Time, r BenchResult) {
+		if windows && len(r.Samples) > 0 && r.Samples[0].histogram != nil {
+			for _, s := range r.Samples {
+				from, to := level.Add(s.Offset-s.Duration), level.Add(s.Offset)
+				out = append(out, namedHistogram{name, from, to, s.histogram})
+				if s.corrected != nil {
+					out = append(out, namedHistogram{name + "-corrected", from, to, s.corrected})
+				}
+			}
+			return
+		}
+		if r.Stat.Histogram != nil {
+			out = append(out, namedHistogram{name, start, end, r.Stat.Histogram})
+		}
+		if r.Stat.CorrectedHistogram != nil {
+			out = append(out, namedHistogram{name + "-corrected", start, end, r.Stat.CorrectedHistogram})
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, r := range results {
+		name := "c" + strconv.Itoa(r.Param.ConnNum)
+		if n := seen[name]; n > 0 {
+			seen[name]++
+			name += "-" + strconv.Itoa(n+1)
+		} else {
+			seen[name] = 1
+		}
+
+		level = r.Start
+		start := r.Start
+		for _, s := range r.Stages {
+			end := start.Add(s.Param.Duration)
+			add(fmt.Sprintf("%s-stage%d", name, s.Stage), start, end, s)
+			start = end
+		}
+		if len(r.Stages) == 0 || !windows {
+			add(name, r.Start, r.Start.Add(r.Elapsed), r)
+		}
+	}
+	return out
+}
+
+// writeHistogramLog writes the histograms of results to path in the
+// HdrHistogram interval log format (.hlog), timed from run: one tagged
+// interval per --interval sample of a level or stage, or per level or stage
+// when not sampled. The total of a staged level is left out, as it is the
+// merge of its stages. Values are in nanoseconds.
+func writeHistogramLog(path string, run time.Time, results []BenchResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := hdrhistogram.NewHistogramLogWriter(f)
+	base := run.UnixMilli()
+	w.SetBaseTime(base)
+	if err := w.OutputLogFormatVersion(); err != nil {
+		return err
+	}
+	if err := w.OutputComment("[wrkb latencies in ns, tagged c<conns>[-stage<n>][-corrected]]"); err != nil {
+		return err
+	}
+	if err := w.OutputStartTime(base); err != nil {
+		return err
+	}
+	if err := w.OutputBaseTime(base); err != nil {
+		return err
+	}
+	if err := w.OutputLegend(); err != nil {
+		return err
+	}
+
+	for _, nh := range resultHistograms(results, true) {
+		// A copy, as the tag and times are stored in the histogram.
+		h := hdrhistogram.Import(nh.hist.Export())
+		h.SetTag(nh.name)
+		h.SetStartTimeMs(nh.start.UnixMilli())
+		h.SetEndTimeMs(nh.end.UnixMilli())
+		if err := w.OutputIntervalHistogram(h); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writePercentileDistributions writes the percentile distribution of every
+// level and stage, in milliseconds, to <prefix>-<name>.hgrm, the text format
+// of HdrHistogram's PercentilesPrint.
+func writePercentileDistributions(prefix string, results []BenchResult) error {
+	for _, nh := range resultHistograms(results, false) {
+		f, err := os.Create(prefix + "-" + nh.name + ".hgrm")
+		if err != nil {
+			return err
+		}
+		if _, err := nh.hist.PercentilesPrint(f, 5, float64(time.Millisecond)); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
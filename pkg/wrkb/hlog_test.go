@@ -0,0 +1,153 @@
+package wrkb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+func TestWriteHistogramLog(t *testing.T) {
+	hist := func(n int, latency time.Duration) *hdrhistogram.Histogram {
+		h := newHistogram()
+		for i := 0; i < n; i++ {
+			_ = h.RecordValue(latency.Nanoseconds())
+		}
+		return h
+	}
+	run := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stage := BenchParam{ConnNum: 4, Duration: time.Second}
+	results := []BenchResult{
+		{Param: BenchParam{ConnNum: 1}, Start: run, Elapsed: time.Second,
+			Stat: BenchStat{Histogram: hist(10, time.Millisecond), CorrectedHistogram: hist(10, 2*time.Millisecond)}},
+		{Param: BenchParam{ConnNum: 4, Stages: []Stage{{}, {}}}, Start: run.Add(2 * time.Second), Elapsed: 2 * time.Second,
+			Stat: BenchStat{Histogram: hist(30, time.Millisecond)},
+			Stages: []BenchResult{
+				{Param: stage, Stage: 1, Stat: BenchStat{Histogram: hist(10, time.Millisecond)}},
+				{Param: stage, Stage: 2, Stat: BenchStat{Histogram: hist(20, time.Millisecond)}},
+			}},
+		{Param: BenchParam{ConnNum: 1}, Start: run.Add(5 * time.Second), Elapsed: time.Second,
+			Stat: BenchStat{Histogram: hist(5, time.Millisecond)}},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.hlog")
+	if err := writeHistogramLog(path, run, results); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	type interval struct {
+		tag        string
+		start, end int64
+		count      int64
+	}
+	var got []interval
+	base := run.UnixMilli()
+	r := hdrhistogram.NewHistogramLogReader(f)
+	for {
+		h, err := r.NextIntervalHistogram()
+		if errors.Is(err, io.EOF) || h == nil && err == nil {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, interval{h.Tag(), h.StartTimeMs() - base, h.EndTimeMs() - base, h.TotalCount()})
+	}
+
+	want := []interval{
+		{"c1", 0, 1000, 10},
+		{"c1-corrected", 0, 1000, 10},
+		{"c4-stage1", 2000, 3000, 10},
+		{"c4-stage2", 3000, 4000, 20},
+		{"c1-2", 5000, 6000, 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got intervals %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("interval %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\nTag=c4-stage1,2.000000,1.000000,1.000") {
+		t.Errorf("expected intervals relative to the run start:\n%s", data)
+	}
+
+	prefix := filepath.Join(dir, "run")
+	if err := writePercentileDistributions(prefix, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"c1", "c1-corrected", "c4-stage1", "c4-stage2", "c4", "c1-2"} {
+		data, err := os.ReadFile(prefix + "-" + name + ".hgrm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), " Value\tPercentile") || !strings.Contains(string(data), "#[Max     = ") {
+			t.Errorf("%s: unexpected distribution:\n%s", name, data)
+		}
+	}
+}
+
+func TestWriteHistogramLog_Samples(t *testing.T) {
+	hist := func(n int) *hdrhistogram.Histogram {
+		h := newHistogram()
+		for i := 0; i < n; i++ {
+			_ = h.RecordValue(time.Millisecond.Nanoseconds())
+		}
+		return h
+	}
+	run := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := []BenchResult{
+		{Param: BenchParam{ConnNum: 2}, Start: run, Elapsed: 2 * time.Second,
+			Stat: BenchStat{Histogram: hist(7)},
+			Samples: []Sample{
+				{Offset: time.Second, Duration: time.Second, histogram: hist(3), corrected: hist(3)},
+				{Offset: 2 * time.Second, Duration: time.Second, histogram: hist(4), corrected: hist(4)},
+			}},
+	}
+
+	path := filepath.Join(t.TempDir(), "run.hlog")
+	if err := writeHistogramLog(path, run, results); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []string
+	r := hdrhistogram.NewHistogramLogReader(f)
+	for {
+		h, err := r.NextIntervalHistogram()
+		if errors.Is(err, io.EOF) || h == nil && err == nil {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %d-%d %d", h.Tag(), h.StartTimeMs()-run.UnixMilli(), h.EndTimeMs()-run.UnixMilli(), h.TotalCount()))
+	}
+
+	want := []string{"c2 0-1000 3", "c2-corrected 0-1000 3", "c2 1000-2000 4", "c2-corrected 1000-2000 4"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got intervals %v, want one per sample %v", got, want)
+	}
+}
@@ -2,7 +2,12 @@ package wrkb
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,65 +18,343 @@ import (
 )
 
 type BenchParam struct {
-	ProcName        string
-	ConnNum         int
-	URL             string
-	Method          string
-	Duration        time.Duration
-	Verbose         bool
-	RPSLimit        float64
-	MaxReqs         int
-	Body            string
-	Headers         []string
-	BestJSONPath    string
-	WriteBestJSON   bool
-	CompareBestJSON bool
+	ProcName         string
+	ConnNum          int
+	URL              string
+	Method           string
+	Duration         time.Duration
+	Verbose          bool
+	RPSLimit         float64
+	OpenLoop         bool
+	MaxReqs          int
+	Stages           []Stage
+	SampleInterval   time.Duration
+	Body             string
+	RawBody          bool
+	Headers          []string
+	Scenario         []RequestTemplate
+	Corpus           *Corpus
+	Seed             int64
+	Percentiles      []float64
+	HTTP2            bool
+	H2C              bool
+	StreamsPerConn   int
+	ConnectTimeout   time.Duration
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	Timeout          time.Duration
+	Warmup           time.Duration
+	WarmupReqs       int
+	Checks           *Checks
+	TLSConfig        *tls.Config
+	NewTransport     NewTransportFunc
+	BestJSONPath     string
+	WriteBestJSON    bool
+	CompareBestJSON  bool
+	ResultsJSONPath  string
+	WriteResultsJSON bool
+	ResultsNDJSON    bool
+	CSVPath          string
+	HlogPath         string
+	HgrmPrefix       string
+
+	onMeasureStart func()
+}
+
+const (
+	defaultConnectTimeout = 3 * time.Second
+	defaultReadTimeout    = 1 * time.Second
+	defaultWriteTimeout   = 1 * time.Second
+)
+
+func (p BenchParam) connectTimeout() time.Duration {
+	return durationOr(p.ConnectTimeout, defaultConnectTimeout)
+}
+
+func (p BenchParam) readTimeout() time.Duration {
+	return durationOr(p.ReadTimeout, defaultReadTimeout)
+}
+
+func (p BenchParam) writeTimeout() time.Duration {
+	return durationOr(p.WriteTimeout, defaultWriteTimeout)
+}
+
+// DefaultPercentiles are the latency percentiles reported when
+// BenchParam.Percentiles is empty.
+var DefaultPercentiles = []float64{50, 90, 99, 99.9}
+
+// handshakePercentiles are the TLS handshake latency percentiles reported.
+var handshakePercentiles = []float64{50, 99}
+
+func (p BenchParam) percentiles() []float64 {
+	if len(p.Percentiles) == 0 {
+		return DefaultPercentiles
+	}
+	return p.Percentiles
+}
+
+// ParsePercentiles parses a comma-separated list of percentiles, such as
+// "50,75,95,99.99", into ascending order without duplicates.
+func ParsePercentiles(s string) ([]float64, error) {
+	var out []float64
+	for _, f := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || !(p > 0 && p <= 100) {
+			return nil, fmt.Errorf("invalid percentile %q, want a number in (0, 100]", f)
+		}
+		out = append(out, p)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// percentileLabel names percentile p: p50, p99.9.
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// templates returns the Scenario, which replaces Method, URL, Headers and
+// Body, or the single request described by those fields. A RawBody is sent
+// byte-exact, without placeholder substitution.
+func (p BenchParam) templates() []RequestTemplate {
+	if len(p.Scenario) > 0 {
+		return p.Scenario
+	}
+	return []RequestTemplate{{Weight: 1, Method: p.Method, URL: p.URL, Headers: p.Headers, Body: p.Body, rawBody: p.RawBody}}
+}
+
+// needsBody reports whether checks or extractions read response bodies.
+func (p BenchParam) needsBody() bool {
+	return p.Checks.needsBody() || templatesNeedBody(p.Scenario)
+}
+
+// countsFailed reports whether responses can be counted as failed.
+func (p BenchParam) countsFailed() bool {
+	return p.Checks != nil || templatesExtract(p.Scenario)
+}
+
+// CheckProtocol reports a target whose scheme the HTTP/2 mode cannot reach:
+// HTTP2 negotiates over TLS and needs https:// URLs, H2C is cleartext and
+// needs http:// ones. Of a Corpus only the base URL is checked, records are
+// read during the run.
+func (p BenchParam) CheckProtocol() error {
+	if !p.HTTP2 && !p.H2C {
+		return nil
+	}
+	if p.HTTP2 && p.H2C {
+		return errors.New("--http2 and --h2c cannot be combined")
+	}
+
+	var urls []string
+	if p.Corpus != nil {
+		urls = append(urls, p.Corpus.baseURL)
+	} else {
+		requests, _ := flattenTemplates(p.templates())
+		for _, t := range requests {
+			urls = append(urls, t.URL)
+		}
+	}
+	for _, u := range urls {
+		switch {
+		case p.HTTP2 && isCleartextURL(u):
+			return fmt.Errorf("--http2 needs an https:// URL, got %s (use --h2c for cleartext HTTP/2)", u)
+		case p.H2C && isTLSURL(u):
+			return fmt.Errorf("--h2c is cleartext HTTP/2 and needs an http:// URL, got %s (use --http2)", u)
+		}
+	}
+	return nil
+}
+
+func (p BenchParam) usesTLS() bool {
+	if p.Corpus != nil {
+		return isTLSURL(p.Corpus.baseURL)
+	}
+	requests, _ := flattenTemplates(p.templates())
+	for _, t := range requests {
+		if isTLSURL(t.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
 }
 
 type BenchStat struct {
-	GoodCnt      int
-	BadCnt       int
-	ErrorCnt     int
-	BodyReqSize  int
-	BodyRespSize int
-	Time         time.Duration
-	Histogram    *hdrhistogram.Histogram
+	GoodCnt            int
+	RedirectCnt        int
+	BadCnt             int
+	FailedCnt          int
+	FailReasons        []string
+	ErrorCnt           int
+	ErrorKindCnt       [errorKindCount]int
+	MissedCnt          int
+	ConnOpenCnt        int
+	ConnReuseCnt       int
+	ConnCloseCnt       int
+	StreamCnt          int
+	HandshakeCnt       int
+	BodyReqSize        int
+	BodyRespSize       int
+	Time               time.Duration
+	Histogram          *hdrhistogram.Histogram
+	CorrectedHistogram *hdrhistogram.Histogram
+	HandshakeHistogram *hdrhistogram.Histogram
+	// StatusCnt counts the responses per status code, and StatusHistograms
+	// holds their latencies per status class. Both are only kept for stats
+	// created with a StatusCnt map: those of a level or a stage.
+	StatusCnt        map[int]int
+	StatusHistograms [statusClassCount]*hdrhistogram.Histogram
+}
+
+// statusClassCount is the number of status classes, 1xx to 5xx.
+const statusClassCount = 5
+
+// statusClass returns the index of the class of status in
+// BenchStat.StatusHistograms, or -1 for a status outside 100-599.
+func statusClass(status int) int {
+	if status < 100 || status >= 600 {
+		return -1
+	}
+	return status/100 - 1
+}
+
+// requests is the number of requests sent, whatever their outcome.
+func (s BenchStat) requests() int {
+	return s.GoodCnt + s.RedirectCnt + s.BadCnt + s.FailedCnt + s.ErrorCnt
 }
 
 func (s BenchStat) Add(other BenchStat) BenchStat {
 	s.GoodCnt += other.GoodCnt
+	s.RedirectCnt += other.RedirectCnt
 	s.BadCnt += other.BadCnt
+	s.FailedCnt += other.FailedCnt
+	for _, reason := range other.FailReasons {
+		s.FailReasons = addFailReason(s.FailReasons, reason)
+	}
 	s.ErrorCnt += other.ErrorCnt
+	for i := range s.ErrorKindCnt {
+		s.ErrorKindCnt[i] += other.ErrorKindCnt[i]
+	}
+	s.MissedCnt += other.MissedCnt
+	s.ConnOpenCnt += other.ConnOpenCnt
+	s.ConnReuseCnt += other.ConnReuseCnt
+	s.ConnCloseCnt += other.ConnCloseCnt
+	s.StreamCnt += other.StreamCnt
+	s.HandshakeCnt += other.HandshakeCnt
 	s.BodyRespSize += other.BodyRespSize
 	s.BodyReqSize += other.BodyReqSize
 	s.Time += other.Time
-
-	if other.Histogram != nil {
-		if s.Histogram == nil {
-			s.Histogram = other.Histogram
-		} else {
-			s.Histogram.Merge(other.Histogram)
+	s.Histogram = mergeHistogram(s.Histogram, other.Histogram)
+	s.CorrectedHistogram = mergeHistogram(s.CorrectedHistogram, other.CorrectedHistogram)
+	s.HandshakeHistogram = mergeHistogram(s.HandshakeHistogram, other.HandshakeHistogram)
+	if len(other.StatusCnt) > 0 && s.StatusCnt == nil {
+		s.StatusCnt = make(map[int]int, len(other.StatusCnt))
+	}
+	for code, n := range other.StatusCnt {
+		s.StatusCnt[code] += n
+	}
+	for i, h := range other.StatusHistograms {
+		if h == nil {
+			continue
+		}
+		// Not mergeHistogram: s would share the histogram of other, which a
+		// worker resets and reuses.
+		if s.StatusHistograms[i] == nil {
+			s.StatusHistograms[i] = newHistogram()
 		}
+		s.StatusHistograms[i].Merge(h)
 	}
 	return s
 }
 
-type BenchResult struct {
-	Param   BenchParam
-	Stat    BenchStat
-	RPS     int
+func mergeHistogram(dst, src *hdrhistogram.Histogram) *hdrhistogram.Histogram {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		return src
+	}
+	dst.Merge(src)
+	return dst
+}
+
+type LatencyStat struct {
 	Latency time.Duration
 	Min     time.Duration
-	P50     time.Duration
-	P90     time.Duration
-	P99     time.Duration
-	P999    time.Duration
-	Max     time.Duration
+	// Percentiles holds the latencies at the percentiles they were
+	// calculated for, BenchParam.Percentiles for results, in order.
+	Percentiles []PercentileValue
+	Max         time.Duration
+}
+
+// PercentileValue is the latency at a percentile, such as 99.9.
+type PercentileValue struct {
+	Percentile float64
+	Value      time.Duration
+}
+
+// Percentile returns the latency at percentile p, or 0 when it was not
+// calculated.
+func (s LatencyStat) Percentile(p float64) time.Duration {
+	for _, v := range s.Percentiles {
+		if v.Percentile == p {
+			return v.Value
+		}
+	}
+	return 0
+}
+
+func calcLatencyStat(h *hdrhistogram.Histogram, percentiles []float64) LatencyStat {
+	if h == nil || h.TotalCount() == 0 {
+		return LatencyStat{}
+	}
+	s := LatencyStat{
+		Latency: time.Duration(h.Mean()) * time.Nanosecond,
+		Min:     time.Duration(h.Min()) * time.Nanosecond,
+		Max:     time.Duration(h.Max()) * time.Nanosecond,
+	}
+	for _, p := range percentiles {
+		s.Percentiles = append(s.Percentiles, PercentileValue{p, time.Duration(h.ValueAtQuantile(p)) * time.Nanosecond})
+	}
+	return s
+}
+
+type BenchResult struct {
+	Param BenchParam
+	Stat  BenchStat
+	RPS   int
+	LatencyStat
+	// Corrected is measured from the intended send time in open-loop mode.
+	Corrected LatencyStat
+	Handshake LatencyStat
+	CPU       float64
+	Threads   int
+	MemRSS    int64
+	// Start and Elapsed are the wall-clock start and time of the
+	// measurement, warm-up excluded.
+	Start   time.Time
+	Elapsed time.Duration
+	// Best marks the result Start picked as the best one.
+	Best bool
+	// Stage is the 1-based stage number of a per-stage result; Stages holds
+	// those results on the result of a staged run.
+	Stage  int
+	Stages []BenchResult
+	// Samples is the time series of the run, one per BenchParam.SampleInterval.
+	Samples []Sample
+	// Templates breaks the result down by scenario template.
+	Templates []TemplateResult
 }
 
 func (r BenchResult) CalcStat() BenchResult {
 
-	totalRequests := r.Stat.GoodCnt + r.Stat.BadCnt + r.Stat.ErrorCnt
+	totalRequests := r.Stat.requests()
 	if totalRequests == 0 {
 		return r
 	}
@@ -82,160 +365,614 @@ func (r BenchResult) CalcStat() BenchResult {
 
 	measuredCount := r.Stat.Histogram.TotalCount()
 	if measuredCount > 0 {
+		r.LatencyStat = calcLatencyStat(r.Stat.Histogram, r.Param.percentiles())
 		r.Latency = time.Duration(r.Stat.Time.Nanoseconds() / measuredCount)
-		r.Min = time.Duration(r.Stat.Histogram.Min()) * time.Nanosecond
-		r.P50 = time.Duration(r.Stat.Histogram.ValueAtQuantile(50.0)) * time.Nanosecond
-		r.P90 = time.Duration(r.Stat.Histogram.ValueAtQuantile(90.0)) * time.Nanosecond
-		r.P99 = time.Duration(r.Stat.Histogram.ValueAtQuantile(99.0)) * time.Nanosecond
-		r.P999 = time.Duration(r.Stat.Histogram.ValueAtQuantile(99.9)) * time.Nanosecond
-		r.Max = time.Duration(r.Stat.Histogram.Max()) * time.Nanosecond
 	}
+	r.Corrected = calcLatencyStat(r.Stat.CorrectedHistogram, r.Param.percentiles())
+	r.Handshake = calcLatencyStat(r.Stat.HandshakeHistogram, handshakePercentiles)
 
 	return r
 }
 
+// Streams derived from a run's Seed besides the workers', which are numbered
+// from 0.
+const (
+	corpusStream = -1 - iota
+	warmupStream
+)
+
 func BenchHTTP(param BenchParam) BenchResult {
+	if param.Seed == 0 {
+		param.Seed = time.Now().UnixNano()
+	}
+	workers := param.ConnNum
+	var profile *loadProfile
+	if len(param.Stages) > 0 {
+		profile = newLoadProfile(param, time.Time{})
+		workers = max(workers, profile.maxConns())
+	}
 
-	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), param.Duration)
-	defer cancelTimeout()
+	transportParam := param
+	transportParam.ConnNum = workers
+	transport := newTransport(transportParam)
+	defer transport.Close()
 
-	ctx := ctxTimeout
-	var cancelAll context.CancelFunc
-	if param.MaxReqs > 0 {
-		ctx, cancelAll = context.WithCancel(ctxTimeout)
-		defer cancelAll()
+	requesters := make([]Requester, workers)
+	for i := range requesters {
+		requesters[i] = transport.Requester(i)
 	}
 
-	client := &fasthttp.Client{
-		ReadTimeout:                   1 * time.Second,
-		WriteTimeout:                  1 * time.Second,
-		MaxIdleConnDuration:           1 * time.Minute,
-		DisablePathNormalizing:        true,
-		DisableHeaderNamesNormalizing: true,
-		NoDefaultUserAgentHeader:      true,
-		Dial: (&fasthttp.TCPDialer{
-			DNSCacheDuration: 1 * time.Hour,
-		}).Dial,
+	// A warm-up would use up records of a stdin corpus that the measurement
+	// then never sends, so there is none.
+	warm := param.Corpus == nil || param.Corpus.replayable()
+	if warm && (param.Warmup > 0 || param.WarmupReqs > 0) {
+		warmup := param
+		warmup.Duration = param.Warmup
+		warmup.MaxReqs = param.WarmupReqs
+		warmup.Stages = nil
+		warmup.SampleInterval = 0
+		// Its own streams, so the measurement does not repeat its requests.
+		warmup.Seed = deriveSeed(param.Seed, warmupStream)
+		runPhase(warmup, transport, requesters[:param.ConnNum])
+	}
+
+	if param.onMeasureStart != nil {
+		param.onMeasureStart()
+	}
+
+	ph := runPhase(param, transport, requesters)
+	stats, samples := ph.stats, ph.samples()
+	if profile == nil {
+		result := newBenchResult(param, stats[0])
+		result.Samples = samples
+		result.Templates = ph.templateResults(result)
+		return result
 	}
 
-	var limiter <-chan time.Time
-	var stopLimiter func()
-	if param.RPSLimit > 0 {
-		interval := time.Duration(float64(time.Second) / param.RPSLimit)
-		if interval <= 0 {
-			interval = time.Nanosecond
+	var stages []BenchResult
+	var stageStart time.Duration
+	for i, s := range profile.stages {
+		stageParam := param
+		stageParam.Stages = nil
+		stageParam.Duration = s.Duration
+		stageParam.ConnNum = profile.to[i].conns
+		if profile.limited {
+			stageParam.RPSLimit = profile.to[i].rps
 		}
 
-		ticker := time.NewTicker(interval)
-		limiter = ticker.C
-		stopLimiter = ticker.Stop
-		defer stopLimiter()
+		r := newBenchResult(stageParam, stats[i])
+		r.RPS = stageRPS(r.Stat, s.Duration)
+		r.Stage = i + 1
+		r.Samples = samplesBetween(samples, stageStart, stageStart+s.Duration)
+		stages = append(stages, r)
+		stageStart += s.Duration
 	}
 
-	stats := make(chan BenchStat, param.ConnNum)
-	wg := sync.WaitGroup{}
-	var reqCount int64
+	total := newStageStat(param.OpenLoop)
+	total.HandshakeHistogram = newHistogram()
+	for _, s := range stats {
+		total = total.Add(s)
+	}
+
+	param.ConnNum = workers
+	result := newBenchResult(param, total)
+	result.RPS = stageRPS(total, profile.duration())
+	result.Stages = stages
+	result.Samples = samples
+	result.Templates = ph.templateResults(result)
+	return result
+}
+
+func newBenchResult(param BenchParam, stat BenchStat) BenchResult {
+	return (BenchResult{
+		Param: param,
+		Stat:  stat,
+	}).CalcStat()
+}
+
+// stageRPS is the request rate over wall-clock time; the connection count
+// changes during a staged run, so the per-connection estimate does not apply.
+func stageRPS(stat BenchStat, d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(float64(stat.requests()) / d.Seconds())
+}
+
+func newHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1_000, 10_000_000_000, 3)
+}
+
+// newCorrectedHistogram covers the longer latencies of requests that fall
+// behind their send slots.
+func newCorrectedHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1_000, 600_000_000_000, 3)
+}
+
+func newStageStat(openLoop bool) BenchStat {
+	stat := BenchStat{Histogram: newHistogram(), StatusCnt: make(map[int]int)}
+	if openLoop {
+		stat.CorrectedHistogram = newCorrectedHistogram()
+	}
+	return stat
+}
+
+// phase is the state shared by the workers of one runPhase call.
+type phase struct {
+	param     BenchParam
+	limiter   *pacer
+	profile   *loadProfile
+	sampler   *sampler
+	picker    *templatePicker
+	corpus    <-chan Request
+	workers   int
+	reqCount  int64
+	cancelAll context.CancelFunc
+
+	mu    sync.Mutex
+	stats []BenchStat
+	// templates holds per-request stats (see flattenTemplates) when the
+	// scenario has several.
+	templates []BenchStat
+}
+
+func (ph *phase) samples() []Sample {
+	if ph.sampler == nil {
+		return nil
+	}
+	return ph.sampler.samples
+}
+
+func (ph *phase) templateResults(r BenchResult) []TemplateResult {
+	if ph.templates == nil {
+		return nil
+	}
+	return templateResults(r, ph.picker.requests, ph.templates)
+}
+
+// flush moves a worker's counters into the stats of the given stage and
+// resets them, keeping the worker's histograms for reuse.
+func (ph *phase) flush(stage int, stat *BenchStat) {
+	ph.mu.Lock()
+	ph.stats[stage] = ph.stats[stage].Add(*stat)
+	ph.mu.Unlock()
+
+	stat.Histogram.Reset()
+	if stat.CorrectedHistogram != nil {
+		stat.CorrectedHistogram.Reset()
+	}
+	for _, h := range stat.StatusHistograms {
+		if h != nil {
+			h.Reset()
+		}
+	}
+	clear(stat.StatusCnt)
+	*stat = BenchStat{
+		Histogram:          stat.Histogram,
+		CorrectedHistogram: stat.CorrectedHistogram,
+		StatusCnt:          stat.StatusCnt,
+		StatusHistograms:   stat.StatusHistograms,
+	}
+}
+
+func (ph *phase) flushTemplates(stats []BenchStat) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	for i, s := range stats {
+		if ph.templates[i].Histogram == nil {
+			ph.templates[i].Histogram = newHistogram()
+		}
+		ph.templates[i] = ph.templates[i].Add(s)
+	}
+}
+
+func (ph *phase) addTransportStat(stage int, stat BenchStat) {
+	ph.mu.Lock()
+	ph.stats[stage] = ph.stats[stage].Add(stat)
+	ph.mu.Unlock()
+}
+
+// runPhase drives the workers until param.Duration elapses or param.MaxReqs
+// requests are sent; a zero Duration means no time limit. With param.Stages
+// the run lasts for the stages and one BenchStat is returned per stage,
+// otherwise a single one. Samples are collected when param.SampleInterval
+// is set.
+func runPhase(param BenchParam, transport Transport, requesters []Requester) *phase {
+	ctx, cancelAll := context.WithCancel(context.Background())
+	defer cancelAll()
+
+	start := time.Now()
+	ph := &phase{
+		param:     param,
+		cancelAll: cancelAll,
+		picker:    newTemplatePicker(param.templates()),
+		workers:   len(requesters),
+		stats:     []BenchStat{newStageStat(param.OpenLoop)},
+	}
+	if param.Corpus != nil {
+		ph.corpus = param.Corpus.stream(ctx, deriveSeed(param.Seed, corpusStream))
+	} else if len(ph.picker.requests) > 1 {
+		ph.templates = make([]BenchStat, len(ph.picker.requests))
+	}
+
+	duration := param.Duration
+	if len(param.Stages) > 0 {
+		ph.profile = newLoadProfile(param, start)
+		duration = ph.profile.duration()
+		ph.stats = make([]BenchStat, len(param.Stages))
+		for i := range ph.stats {
+			ph.stats[i] = newStageStat(param.OpenLoop)
+		}
+	}
+
+	if duration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, duration)
+		defer cancelTimeout()
+	}
+
+	switch {
+	case ph.profile != nil && ph.profile.limited:
+		ph.limiter = &pacer{rate: ph.profile.rate, openLoop: param.OpenLoop}
+	case param.RPSLimit > 0:
+		ph.limiter = newPacer(param.RPSLimit, param.OpenLoop)
+	}
+
+	var samplerDone chan struct{}
+	samplerCtx, stopSampler := context.WithCancel(context.Background())
+	defer stopSampler()
+	if param.SampleInterval > 0 {
+		ph.sampler = newSampler(param, param.OpenLoop && ph.limiter != nil, len(requesters), start)
+		samplerDone = make(chan struct{})
+		go func() {
+			defer close(samplerDone)
+			ph.sampler.run(samplerCtx)
+		}()
+	}
 
-	for i := 0; i < param.ConnNum; i++ {
+	wg := sync.WaitGroup{}
+	for i, requester := range requesters {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			stats <- runWorker(ctx, param, client, limiter, &reqCount, cancelAll)
+			runWorker(ctx, ph, i, requester)
 		}()
 	}
 
-	go func() {
-		wg.Wait()
-		close(stats)
-	}()
+	if ph.profile != nil {
+		// Attribute connection counters to the stage they were collected in.
+		end := ph.profile.start
+		for i, s := range ph.profile.stages[:len(ph.profile.stages)-1] {
+			end = end.Add(s.Duration)
+			if !sleepUntil(ctx, end) {
+				break
+			}
+			ph.addTransportStat(i, transport.Stat())
+		}
+	}
+
+	wg.Wait()
+	ph.addTransportStat(len(ph.stats)-1, transport.Stat())
 
-	final := BenchStat{}
-	for s := range stats {
-		final = final.Add(s)
+	if ph.sampler != nil {
+		stopSampler()
+		<-samplerDone
+		ph.sampler.collect(time.Now(), true)
 	}
+	return ph
+}
 
-	return (BenchResult{
-		Param: param,
-		Stat:  final,
-	}).CalcStat()
+// fastHTTPTransport gives every worker its own client limited to a single
+// connection, so the -c level is the number of TCP connections in use. HTTPS
+// requests go through a second client per worker, created on first use.
+type fastHTTPTransport struct {
+	param     BenchParam
+	tlsConfig *tls.Config
+	tracker   connTracker
+	mu        sync.Mutex
+	clients   []*workerClient
+}
+
+// workerClient is the client of one worker. It has at most one connection,
+// conn, so a request that did not dial went over the open connection.
+type workerClient struct {
+	*fasthttp.Client
+	dials atomic.Int64
+	conn  atomic.Pointer[trackedConn]
+}
+
+func newFastHTTPTransport(param BenchParam) *fastHTTPTransport {
+	return &fastHTTPTransport{param: param, tlsConfig: clientTLSConfig(param.TLSConfig)}
+}
+
+func (t *fastHTTPTransport) newClient(useTLS bool) *workerClient {
+	dialer := &fasthttp.TCPDialer{
+		DNSCacheDuration: 1 * time.Hour,
+	}
+	wc := &workerClient{}
+	wc.Client = &fasthttp.Client{
+		ReadTimeout:                   t.param.readTimeout(),
+		WriteTimeout:                  t.param.writeTimeout(),
+		MaxIdleConnDuration:           1 * time.Minute,
+		MaxConnsPerHost:               1,
+		DisablePathNormalizing:        true,
+		DisableHeaderNamesNormalizing: true,
+		NoDefaultUserAgentHeader:      true,
+		Dial: func(addr string) (net.Conn, error) {
+			wc.dials.Add(1)
+			conn, err := t.tracker.track(dialer.DialTimeout(addr, t.param.connectTimeout()))
+			if err != nil {
+				return nil, err
+			}
+			wc.conn.Store(conn.(*trackedConn))
+			if !useTLS {
+				return conn, nil
+			}
+			return t.tracker.handshake(conn, t.tlsConfig, addr, t.param.connectTimeout())
+		},
+	}
+
+	t.mu.Lock()
+	t.clients = append(t.clients, wc)
+	t.mu.Unlock()
+	return wc
+}
+
+func (t *fastHTTPTransport) Requester(int) Requester {
+	param := t.param
+	client := t.newClient(false)
+	var tlsClient *workerClient
+
+	req := &fasthttp.Request{}
+	resp := &fasthttp.Response{}
+	decode := param.needsBody()
+	var decoded []byte
+	header := func(name string) (string, bool) {
+		v := resp.Header.Peek(name)
+		return string(v), v != nil
+	}
+
+	return RequesterFunc(func(_ context.Context, r *Request) Outcome {
+		req.Reset()
+		resp.Reset()
+
+		req.Header.SetMethod(r.Method)
+		req.SetRequestURI(r.URL)
+		setHeaders(req, r.Headers)
+		out := Outcome{ReqBytes: setBody(req, r.Body, hasHeader(r.Headers, "Content-Type"))}
+		logRequest(req, param.Verbose)
+
+		c := client
+		if isTLSURL(r.URL) {
+			if tlsClient == nil {
+				tlsClient = t.newClient(true)
+			}
+			c = tlsClient
+		}
+
+		dials := c.dials.Load()
+		out.Start = time.Now()
+		if param.Timeout > 0 {
+			out.Err = c.DoTimeout(req, resp, param.Timeout)
+		} else {
+			out.Err = c.Do(req, resp)
+		}
+		out.End = time.Now()
+		if c.dials.Load() == dials {
+			t.tracker.reusedConn()
+		}
+
+		if out.Err != nil {
+			return out
+		}
+
+		logResponse(resp, param.Verbose, out.End.Sub(out.Start))
+		if resp.ConnectionClose() {
+			if conn := c.conn.Load(); conn != nil {
+				conn.markPeerClosed()
+			}
+		}
+		out.Status = resp.StatusCode()
+		out.Body = resp.Body()
+		out.RespBytes = len(out.Body)
+		out.Header = header
+		if enc := resp.Header.ContentEncoding(); decode && len(enc) > 0 {
+			decoded, out.Err = decodeBody(decoded[:0], string(enc), out.Body)
+			out.Body = decoded
+		}
+		return out
+	})
+}
+
+func (t *fastHTTPTransport) Stat() BenchStat {
+	return t.tracker.stat()
+}
+
+func (t *fastHTTPTransport) Close() {
+	for _, c := range t.clients {
+		c.CloseIdleConnections()
+	}
 }
 
-func runWorker(
-	ctx context.Context,
-	param BenchParam,
-	client *fasthttp.Client,
-	limiter <-chan time.Time,
-	reqCount *int64,
-	cancelAll context.CancelFunc) BenchStat {
+func runWorker(ctx context.Context, ph *phase, worker int, requester Requester) {
+	param := ph.param
+	stat := newStageStat(param.OpenLoop)
+	// Open-loop correction measures from the send slots of a rate; without
+	// one there is nothing to be behind.
+	openLoop := param.OpenLoop && ph.limiter != nil
+	stage := 0
+	defer func() { ph.flush(stage, &stat) }()
 
-	stat := BenchStat{Histogram: hdrhistogram.New(1_000, 10_000_000_000, 3)}
-	hasContentTypeHeader := hasHeader(param.Headers, "Content-Type")
+	var window *sampleWindow
+	if ph.sampler != nil {
+		window = ph.sampler.windows[worker]
+	}
+
+	var templateStats []BenchStat
+	if ph.templates != nil {
+		templateStats = make([]BenchStat, len(ph.templates))
+		defer func() { ph.flushTemplates(templateStats) }()
+	}
+	var req Request
+	var seq sequence
+	rng := newRand(deriveSeed(param.Seed, worker))
+	sub := substitution{rng: rng}
+	if param.Seed != 0 {
+		sub.seq = newSeqI64Stride(worker, ph.workers)
+	}
+	vars := make(map[string]string)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return stat
+			return
 		default:
 
-			if limiter != nil {
-				select {
-				case <-limiter:
-				case <-ctx.Done():
-					return stat
+			if ph.profile != nil {
+				if _, target := ph.profile.at(time.Now()); worker >= target.conns {
+					if !sleepUntil(ctx, time.Now().Add(pausePoll)) {
+						return
+					}
+					continue
+				}
+			}
+
+			var slot time.Time
+			if ph.limiter != nil {
+				var ok bool
+				if slot, ok = ph.limiter.wait(ctx); !ok {
+					return
 				}
 			}
 
 			if param.MaxReqs > 0 {
-				next := int(atomic.AddInt64(reqCount, 1))
+				next := int(atomic.AddInt64(&ph.reqCount, 1))
 				if next > param.MaxReqs {
-					if cancelAll != nil {
-						cancelAll()
-					}
-					return stat
+					ph.cancelAll()
+					return
 				}
 			}
 
-			req := fasthttp.AcquireRequest()
+			if ph.profile != nil {
+				at := slot
+				if at.IsZero() {
+					at = time.Now()
+				}
+				if i, _ := ph.profile.at(at); i != stage {
+					ph.flush(stage, &stat)
+					stage = i
+				}
+			}
 
-			req.Header.SetMethod(param.Method)
-			req.SetRequestURI(substitute(param.URL))
-			setHeaders(req, param.Headers)
-			stat.BodyReqSize += setBody(req, param.Body, hasContentTypeHeader)
-			logRequest(req, param.Verbose)
+			ti := -1
+			var tmpl *RequestTemplate
+			if ph.corpus != nil {
+				var ok bool
+				if req, ok = <-ph.corpus; !ok {
+					// The corpus ended, or ctx is done and the next
+					// iteration returns.
+					ph.cancelAll()
+					return
+				}
+			} else {
+				ti = seq.next(ph.picker, rng)
+				tmpl = &ph.picker.requests[ti]
+				req = tmpl.render(&sub, vars)
+			}
 
-			resp := fasthttp.AcquireResponse()
+			out := requester.Do(ctx, &req)
+			stat.BodyReqSize += out.ReqBytes
+			if openLoop && ph.limiter.missed(slot, out.Start) {
+				stat.MissedCnt++
+			}
 
-			start := time.Now()
-			err := client.Do(req, resp)
-			elapsed := time.Since(start)
-			fasthttp.ReleaseRequest(req)
+			var failReason string
+			if out.Err == nil {
+				failReason = param.Checks.check(out)
+			}
+			if tmpl != nil {
+				if failReason == "" && continuesSequence(out) {
+					failReason = tmpl.extract(out, vars)
+				}
+				seq.done(ph.picker, failReason == "" && continuesSequence(out))
+			}
+			recordOutcome(&stat, out, failReason)
+			if window != nil {
+				window.add(out, failReason, slot)
+			}
+			if templateStats != nil {
+				ts := &templateStats[ti]
+				if ts.Histogram == nil {
+					ts.Histogram = newHistogram()
+				}
+				ts.BodyReqSize += out.ReqBytes
+				recordOutcome(ts, out, failReason)
+			}
 
-			if err != nil {
-				fasthttp.ReleaseResponse(resp)
-				stat.ErrorCnt++
+			if out.Err != nil {
 				if param.Verbose {
-					fmt.Printf("ERR: %v\n", err)
+					fmt.Printf("ERR: %v\n", out.Err)
 				}
 				continue
 			}
 
-			logResponse(resp, param.Verbose, elapsed)
-			updateStatistic(&stat, resp, elapsed)
-
-			fasthttp.ReleaseResponse(resp)
+			if openLoop {
+				stat.CorrectedHistogram.RecordValue(out.End.Sub(slot).Nanoseconds())
+			}
 		}
 	}
 }
 
-func updateStatistic(stat *BenchStat, resp *fasthttp.Response, elapsed time.Duration) {
+// isSuccess reports a response counted as good: 2xx.
+func isSuccess(out Outcome) bool {
+	return out.Err == nil && out.Status >= 200 && out.Status < 300
+}
+
+// continuesSequence reports a response whose values are extracted and after
+// which a sequence goes on: 2xx or 3xx, so that a login answering with a
+// redirect and a cookie can start one.
+func continuesSequence(out Outcome) bool {
+	return out.Err == nil && out.Status >= 200 && out.Status < 400
+}
+
+// isRedirect reports a 3xx response, counted apart from good and bad.
+func isRedirect(out Outcome) bool {
+	return out.Err == nil && out.Status >= 300 && out.Status < 400
+}
+
+// recordOutcome adds a request to stat; failReason is the failed check, if any.
+func recordOutcome(stat *BenchStat, out Outcome, failReason string) {
+	if out.Err != nil {
+		stat.ErrorCnt++
+		stat.ErrorKindCnt[classifyError(out.Err)]++
+		return
+	}
+	updateStatistic(stat, out, failReason)
+}
+
+func updateStatistic(stat *BenchStat, out Outcome, failReason string) {
+	elapsed := out.End.Sub(out.Start)
 	stat.Time += elapsed
 	stat.Histogram.RecordValue(elapsed.Nanoseconds())
+	if stat.StatusCnt != nil {
+		stat.StatusCnt[out.Status]++
+		if c := statusClass(out.Status); c >= 0 {
+			if stat.StatusHistograms[c] == nil {
+				stat.StatusHistograms[c] = newHistogram()
+			}
+			stat.StatusHistograms[c].RecordValue(elapsed.Nanoseconds())
+		}
+	}
 
-	code := resp.StatusCode()
 	switch {
-	case code >= 200 && code < 400:
+	case failReason != "":
+		stat.FailedCnt++
+		stat.FailReasons = addFailReason(stat.FailReasons, failReason)
+	case isSuccess(out):
 		stat.GoodCnt++
-		stat.BodyRespSize += len(resp.Body())
+		stat.BodyRespSize += out.RespBytes
+	case isRedirect(out):
+		stat.RedirectCnt++
 	default:
 		stat.BadCnt++
 	}
@@ -287,7 +1024,6 @@ func setBody(req *fasthttp.Request, body string, hasContentTypeHeader bool) int
 
 	if body != "" {
 
-		body = substitute(body)
 		req.SetBodyString(body)
 
 		if !hasContentTypeHeader {
@@ -300,6 +1036,29 @@ func setBody(req *fasthttp.Request, body string, hasContentTypeHeader bool) int
 	return 0
 }
 
+// decodeBody appends body to dst with its Content-Encoding undone, so checks
+// and extractions see what curl --compressed would print. Unknown encodings
+// are left as they are.
+func decodeBody(dst []byte, encoding string, body []byte) ([]byte, error) {
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		dst, err = fasthttp.AppendGunzipBytes(dst, body)
+	case "deflate":
+		dst, err = fasthttp.AppendInflateBytes(dst, body)
+	case "br":
+		dst, err = fasthttp.AppendUnbrotliBytes(dst, body)
+	case "zstd":
+		dst, err = fasthttp.AppendUnzstdBytes(dst, body)
+	default:
+		return append(dst, body...), nil
+	}
+	if err != nil {
+		return dst, fmt.Errorf("decode %s body: %w", encoding, err)
+	}
+	return dst, nil
+}
+
 func logRequest(req *fasthttp.Request, isVerbose bool) {
 	if isVerbose {
 		fmt.Printf("*   Trying %s...\n", req.URI().Host())
@@ -311,7 +1070,7 @@ func logRequest(req *fasthttp.Request, isVerbose bool) {
 		})
 		body := req.Body()
 		if len(body) > 0 {
-			fmt.Printf(">\n> %s\n", body)
+			fmt.Printf(">\n> %s\n", printableBody(body))
 		}
 		fmt.Printf("> \n* Request completely sent off\n")
 	}
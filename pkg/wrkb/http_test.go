@@ -1,10 +1,15 @@
 package wrkb
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -114,6 +119,746 @@ func TestBenchHTTP_AutoContentType(t *testing.T) {
 	}
 }
 
+func TestBenchHTTP_OpenLoopCorrection(t *testing.T) {
+	param := baseParams(1, "/slow")
+	param.RPSLimit = 100
+	param.OpenLoop = true
+
+	res := BenchHTTP(param)
+
+	if res.Stat.CorrectedHistogram == nil || res.Stat.CorrectedHistogram.TotalCount() == 0 {
+		t.Fatalf("expected corrected histogram to be recorded")
+	}
+	if res.Stat.MissedCnt == 0 {
+		t.Fatalf("expected missed requests when the server is slower than the schedule")
+	}
+	if res.Corrected.Percentile(99) < res.Percentile(99) {
+		t.Fatalf("expected corrected p99 >= raw p99, got %v < %v", res.Corrected.Percentile(99), res.Percentile(99))
+	}
+}
+
+func TestBenchHTTP_OpenLoopWithoutRate(t *testing.T) {
+	stage, err := ParseStage("200ms:c=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, param := range map[string]BenchParam{
+		"fixed":  {URL: mockServerURL, Method: "GET", ConnNum: 2, Duration: time.Second, MaxReqs: 20, OpenLoop: true},
+		"staged": {URL: mockServerURL, Method: "GET", ConnNum: 1, Stages: []Stage{stage}, MaxReqs: 20, OpenLoop: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := BenchHTTP(param)
+
+			if res.Stat.GoodCnt == 0 {
+				t.Fatalf("expected requests without a rate, got none")
+			}
+			if res.Stat.MissedCnt != 0 || res.Stat.CorrectedHistogram.TotalCount() != 0 {
+				t.Fatalf("expected no correction without send slots, got missed=%d corrected=%d",
+					res.Stat.MissedCnt, res.Stat.CorrectedHistogram.TotalCount())
+			}
+		})
+	}
+}
+
+func TestBenchHTTP_ConnectionPerWorker(t *testing.T) {
+	param := baseParams(4, "/")
+	param.MaxReqs = 200
+
+	res := BenchHTTP(param)
+
+	if res.Stat.ConnOpenCnt != 4 {
+		t.Fatalf("expected 4 connections for 4 workers, got %d", res.Stat.ConnOpenCnt)
+	}
+	if res.Stat.ConnReuseCnt != 196 {
+		t.Fatalf("expected 196 reused requests, got %d", res.Stat.ConnReuseCnt)
+	}
+}
+
+func TestBenchHTTP_RefusedConnectionsNotReused(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	res := BenchHTTP(BenchParam{URL: closed.URL, Method: "GET", ConnNum: 1, Duration: 2 * time.Second, MaxReqs: 3})
+
+	if res.Stat.ErrorCnt != 3 || res.Stat.ConnOpenCnt != 0 || res.Stat.ConnReuseCnt != 0 {
+		t.Fatalf("expected 3 errors without connections, got err=%d open=%d reuse=%d",
+			res.Stat.ErrorCnt, res.Stat.ConnOpenCnt, res.Stat.ConnReuseCnt)
+	}
+}
+
+func TestBenchHTTP_ServerClosedConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	param := BenchParam{
+		URL:      srv.URL,
+		Method:   "GET",
+		ConnNum:  1,
+		Duration: 2 * time.Second,
+		MaxReqs:  5,
+	}
+
+	res := BenchHTTP(param)
+
+	if res.Stat.ConnOpenCnt != 5 || res.Stat.ConnCloseCnt != 5 {
+		t.Fatalf("expected 5 opened and 5 server-closed connections, got open=%d closed=%d",
+			res.Stat.ConnOpenCnt, res.Stat.ConnCloseCnt)
+	}
+}
+
+func TestBenchHTTP_Warmup(t *testing.T) {
+	var total int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&total, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	var atMeasureStart int64
+	param := BenchParam{
+		URL:        srv.URL,
+		Method:     "GET",
+		ConnNum:    1,
+		Duration:   2 * time.Second,
+		MaxReqs:    10,
+		WarmupReqs: 5,
+		onMeasureStart: func() {
+			atMeasureStart = atomic.LoadInt64(&total)
+		},
+	}
+
+	res := BenchHTTP(param)
+
+	if atMeasureStart != 5 {
+		t.Fatalf("expected measurement to start after 5 warm-up requests, got %d", atMeasureStart)
+	}
+	if got := atomic.LoadInt64(&total); got != 15 {
+		t.Fatalf("expected 15 requests on the server, got %d", got)
+	}
+	if res.Stat.GoodCnt != 10 || res.Stat.Histogram.TotalCount() != 10 {
+		t.Fatalf("expected warm-up to be excluded, got good=%d recorded=%d",
+			res.Stat.GoodCnt, res.Stat.Histogram.TotalCount())
+	}
+	if res.Stat.ConnOpenCnt != 0 || res.Stat.ConnReuseCnt != 10 {
+		t.Fatalf("expected the warm connection to be reused, got open=%d reuse=%d",
+			res.Stat.ConnOpenCnt, res.Stat.ConnReuseCnt)
+	}
+}
+
+func TestBenchHTTP_H2C(t *testing.T) {
+	var h2 int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			atomic.AddInt64(&h2, 1)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	param := BenchParam{
+		URL:            srv.URL,
+		Method:         "GET",
+		ConnNum:        4,
+		Duration:       2 * time.Second,
+		MaxReqs:        100,
+		H2C:            true,
+		StreamsPerConn: 2,
+	}
+
+	res := BenchHTTP(param)
+
+	if res.Stat.GoodCnt != 100 {
+		t.Fatalf("expected 100 good responses, got %d (err=%d)", res.Stat.GoodCnt, res.Stat.ErrorCnt)
+	}
+	if got := atomic.LoadInt64(&h2); got != 100 {
+		t.Fatalf("expected 100 HTTP/2 requests on the server, got %d", got)
+	}
+	if res.Stat.ConnOpenCnt != 2 {
+		t.Fatalf("expected 2 connections for 4 workers with 2 streams each, got %d", res.Stat.ConnOpenCnt)
+	}
+	if res.Stat.StreamCnt != 100 {
+		t.Fatalf("expected 100 streams, got %d", res.Stat.StreamCnt)
+	}
+}
+
+func TestBenchParam_CheckProtocol(t *testing.T) {
+	scenario := []RequestTemplate{{Weight: 1, Steps: []RequestTemplate{{URL: "https://a/"}, {URL: "http://a/"}}}}
+	tests := []struct {
+		param BenchParam
+		ok    bool
+	}{
+		{BenchParam{URL: "http://a/"}, true},
+		{BenchParam{URL: "https://a/", HTTP2: true}, true},
+		{BenchParam{URL: "http://a/", H2C: true}, true},
+		{BenchParam{URL: "http://a/", HTTP2: true}, false},
+		{BenchParam{URL: "HTTPS://a/", H2C: true}, false},
+		{BenchParam{URL: "http://a/", HTTP2: true, H2C: true}, false},
+		{BenchParam{Scenario: scenario, HTTP2: true}, false},
+		{BenchParam{Scenario: scenario, H2C: true}, false},
+		{BenchParam{Corpus: &Corpus{baseURL: "https://a"}, H2C: true}, false},
+		{BenchParam{Corpus: &Corpus{}, H2C: true}, true},
+	}
+	for i, tt := range tests {
+		if err := tt.param.CheckProtocol(); (err == nil) != tt.ok {
+			t.Errorf("case %d: got %v, want ok=%v", i, err, tt.ok)
+		}
+	}
+}
+
+func TestBenchHTTP_CompressedBody(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(`{"status":"hello"}`))
+	_ = zw.Close()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gz.Bytes())
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	checks, err := CheckOptions{BodyContains: "hello", JSON: "$.status=hello"}.Checks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h2c := range []bool{false, true} {
+		res := BenchHTTP(BenchParam{
+			URL:      srv.URL,
+			Method:   "GET",
+			Headers:  []string{"Accept-Encoding: gzip"},
+			ConnNum:  1,
+			Duration: 2 * time.Second,
+			MaxReqs:  10,
+			H2C:      h2c,
+			Checks:   checks,
+		})
+
+		if res.Stat.GoodCnt != 10 {
+			t.Fatalf("h2c=%v: expected checks to pass on the decoded body, got good=%d failed=%d err=%d",
+				h2c, res.Stat.GoodCnt, res.Stat.FailedCnt, res.Stat.ErrorCnt)
+		}
+		if want := 10 * gz.Len(); res.Stat.BodyRespSize != want {
+			t.Fatalf("h2c=%v: expected %d encoded bytes received, got %d", h2c, want, res.Stat.BodyRespSize)
+		}
+	}
+}
+
+type stubTransport struct{ calls int64 }
+
+func (t *stubTransport) Requester(int) Requester {
+	return RequesterFunc(func(context.Context, *Request) Outcome {
+		n := atomic.AddInt64(&t.calls, 1)
+		now := time.Now()
+		out := Outcome{Status: 200, ReqBytes: 1, RespBytes: 2, Start: now, End: now.Add(time.Millisecond)}
+		if n%2 == 0 {
+			out.Status = 503
+		}
+		return out
+	})
+}
+
+func (t *stubTransport) Stat() BenchStat { return BenchStat{ConnOpenCnt: 3, ConnReuseCnt: 7} }
+
+func (t *stubTransport) Close() {}
+
+func TestBenchHTTP_CustomTransport(t *testing.T) {
+	stub := &stubTransport{}
+	param := BenchParam{
+		ConnNum:      2,
+		Duration:     2 * time.Second,
+		MaxReqs:      10,
+		NewTransport: func(BenchParam) Transport { return stub },
+	}
+
+	res := BenchHTTP(param)
+
+	if res.Stat.GoodCnt != 5 || res.Stat.BadCnt != 5 {
+		t.Fatalf("expected 5 good and 5 bad, got good=%d bad=%d", res.Stat.GoodCnt, res.Stat.BadCnt)
+	}
+	if res.Stat.BodyReqSize != 10 || res.Stat.BodyRespSize != 10 {
+		t.Fatalf("unexpected body sizes: req=%d resp=%d", res.Stat.BodyReqSize, res.Stat.BodyRespSize)
+	}
+	if res.Stat.ConnOpenCnt != 3 || res.Stat.ConnReuseCnt != 7 {
+		t.Fatalf("expected transport stat to be merged, got open=%d reuse=%d", res.Stat.ConnOpenCnt, res.Stat.ConnReuseCnt)
+	}
+	if res.Latency != time.Millisecond {
+		t.Fatalf("expected mean latency of 1ms, got %v", res.Latency)
+	}
+}
+
+// statusTransport answers the requests with statuses in turn.
+type statusTransport struct {
+	statuses []int
+	calls    int64
+}
+
+func (t *statusTransport) Requester(int) Requester {
+	return RequesterFunc(func(context.Context, *Request) Outcome {
+		n := atomic.AddInt64(&t.calls, 1)
+		now := time.Now()
+		return Outcome{Status: t.statuses[int(n-1)%len(t.statuses)], Start: now, End: now.Add(time.Millisecond)}
+	})
+}
+
+func (t *statusTransport) Stat() BenchStat { return BenchStat{} }
+
+func (t *statusTransport) Close() {}
+
+func TestBenchHTTP_StatusCodes(t *testing.T) {
+	stub := &statusTransport{statuses: []int{200, 200, 204, 301, 404, 429, 429, 503, 200, 302}}
+	param := BenchParam{
+		ConnNum:      2,
+		Duration:     2 * time.Second,
+		MaxReqs:      20,
+		NewTransport: func(BenchParam) Transport { return stub },
+	}
+
+	res := BenchHTTP(param)
+
+	if res.Stat.GoodCnt != 8 || res.Stat.RedirectCnt != 4 || res.Stat.BadCnt != 8 {
+		t.Fatalf("expected 8 good, 4 redirects and 8 bad, got good=%d redirect=%d bad=%d",
+			res.Stat.GoodCnt, res.Stat.RedirectCnt, res.Stat.BadCnt)
+	}
+	want := map[int]int{200: 6, 204: 2, 301: 2, 302: 2, 404: 2, 429: 4, 503: 2}
+	if fmt.Sprint(res.Stat.StatusCnt) != fmt.Sprint(want) {
+		t.Fatalf("got status counts %v, want %v", res.Stat.StatusCnt, want)
+	}
+	for class, n := range []int64{0, 8, 4, 6, 2} {
+		h := res.Stat.StatusHistograms[class]
+		if n == 0 && h != nil || n > 0 && (h == nil || h.TotalCount() != n) {
+			t.Errorf("%dxx: expected %d latencies, got %v", class+1, n, h)
+		}
+	}
+
+	rows := statusRows(param, res)
+	if len(rows) != 4 || rows[0].class != "2xx" || rows[0].codes != "200:6 204:2" || rows[2].count != 6 {
+		t.Errorf("unexpected breakdown %+v", rows)
+	}
+}
+
+func TestBenchHTTP_Stages(t *testing.T) {
+	var active, peak int64
+	param := BenchParam{
+		ConnNum: 1,
+		Stages: []Stage{
+			{Duration: 300 * time.Millisecond, Conns: 4, RPS: 200},
+			{Duration: 300 * time.Millisecond, Conns: 1, RPS: 0},
+		},
+		NewTransport: func(p BenchParam) Transport {
+			if p.ConnNum != 4 {
+				t.Errorf("expected transport sized for 4 workers, got %d", p.ConnNum)
+			}
+			return &countingTransport{Transport: &stubTransport{}, active: &active, peak: &peak}
+		},
+	}
+
+	res := BenchHTTP(param)
+
+	if len(res.Stages) != 2 {
+		t.Fatalf("expected 2 stage results, got %d", len(res.Stages))
+	}
+	first, second := res.Stages[0], res.Stages[1]
+	if first.Stage != 1 || first.Param.ConnNum != 4 || first.Param.RPSLimit != 200 {
+		t.Fatalf("unexpected first stage: stage=%d conns=%d rps=%v", first.Stage, first.Param.ConnNum, first.Param.RPSLimit)
+	}
+	// The rate ramps from 0 to 200 rps over 300ms: about 30 requests.
+	if n := first.Stat.GoodCnt + first.Stat.BadCnt; n < 10 || n > 45 {
+		t.Fatalf("expected about 30 requests in the ramp-up, got %d", n)
+	}
+	if n := second.Stat.GoodCnt + second.Stat.BadCnt; n < 10 || n > 45 {
+		t.Fatalf("expected about 30 requests in the ramp-down, got %d", n)
+	}
+
+	total := res.Stat.GoodCnt + res.Stat.BadCnt
+	if total != first.Stat.GoodCnt+first.Stat.BadCnt+second.Stat.GoodCnt+second.Stat.BadCnt {
+		t.Fatalf("expected the total to sum the stages, got %d", total)
+	}
+	if res.Stat.Histogram.TotalCount() != int64(total) {
+		t.Fatalf("expected %d latencies in the total histogram, got %d", total, res.Stat.Histogram.TotalCount())
+	}
+	if first.Stat.Histogram.TotalCount()+second.Stat.Histogram.TotalCount() != int64(total) {
+		t.Fatalf("stage histograms were modified by the total")
+	}
+	if got := atomic.LoadInt64(&peak); got > 4 {
+		t.Fatalf("expected at most 4 concurrent workers, got %d", got)
+	}
+}
+
+type countingTransport struct {
+	Transport
+	active *int64
+	peak   *int64
+}
+
+func (t *countingTransport) Requester(worker int) Requester {
+	inner := t.Transport.Requester(worker)
+	return RequesterFunc(func(ctx context.Context, req *Request) Outcome {
+		n := atomic.AddInt64(t.active, 1)
+		defer atomic.AddInt64(t.active, -1)
+		for {
+			p := atomic.LoadInt64(t.peak)
+			if n <= p || atomic.CompareAndSwapInt64(t.peak, p, n) {
+				break
+			}
+		}
+		return inner.Do(ctx, req)
+	})
+}
+
+func TestBenchHTTP_Samples(t *testing.T) {
+	param := BenchParam{
+		ConnNum:        2,
+		Duration:       time.Second,
+		RPSLimit:       200,
+		SampleInterval: 250 * time.Millisecond,
+		Percentiles:    []float64{75, 99.9},
+		NewTransport:   func(BenchParam) Transport { return &stubTransport{} },
+	}
+
+	res := BenchHTTP(param)
+
+	if len(res.Samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d: %+v", len(res.Samples), res.Samples)
+	}
+
+	good, bad := 0, 0
+	for i, s := range res.Samples {
+		if s.RPS < 150 || s.RPS > 250 {
+			t.Errorf("sample %d: expected about 200 rps, got %d", i, s.RPS)
+		}
+		if len(s.Percentiles) != 2 || s.Percentile(75) < time.Millisecond || s.Max < s.Percentile(99.9) {
+			t.Errorf("sample %d: unexpected latencies %+v max=%v", i, s.Percentiles, s.Max)
+		}
+		good += s.Good
+		bad += s.Bad
+	}
+	if good != res.Stat.GoodCnt || bad != res.Stat.BadCnt {
+		t.Fatalf("expected samples to add up to good=%d bad=%d, got good=%d bad=%d",
+			res.Stat.GoodCnt, res.Stat.BadCnt, good, bad)
+	}
+	if last := res.Samples[3]; last.Offset < time.Second {
+		t.Fatalf("expected the last sample to end with the run, got %v", last.Offset)
+	}
+}
+
+func TestBenchHTTP_Scenario(t *testing.T) {
+	param := BenchParam{
+		ConnNum:  2,
+		Duration: 2 * time.Second,
+		MaxReqs:  400,
+		Scenario: []RequestTemplate{
+			{Name: "ok", Weight: 3, Method: "GET", URL: mockServerURL + "/"},
+			{Name: "bad", Weight: 1, Method: "GET", URL: mockServerURL + "/bad"},
+		},
+	}
+
+	res := BenchHTTP(param)
+
+	if len(res.Templates) != 2 {
+		t.Fatalf("expected 2 template results, got %d", len(res.Templates))
+	}
+	ok, bad := res.Templates[0], res.Templates[1]
+	if ok.Stat.BadCnt != 0 || bad.Stat.GoodCnt != 0 {
+		t.Fatalf("expected statuses to be attributed per template, got ok=%+v bad=%+v", ok.Stat, bad.Stat)
+	}
+	if ok.Stat.GoodCnt != res.Stat.GoodCnt || bad.Stat.BadCnt != res.Stat.BadCnt {
+		t.Fatalf("expected templates to add up to the aggregate, got %d/%d vs %d/%d",
+			ok.Stat.GoodCnt, bad.Stat.BadCnt, res.Stat.GoodCnt, res.Stat.BadCnt)
+	}
+	if ok.Stat.GoodCnt < 240 || ok.Stat.GoodCnt > 360 {
+		t.Fatalf("expected about 300 requests for weight 3 of 4, got %d", ok.Stat.GoodCnt)
+	}
+	if ok.RPS+bad.RPS > res.RPS || ok.RPS <= bad.RPS {
+		t.Fatalf("unexpected template rps: ok=%d bad=%d total=%d", ok.RPS, bad.RPS, res.RPS)
+	}
+	if ok.Percentile(50) <= 0 || bad.Percentile(50) <= 0 {
+		t.Fatalf("expected per-template percentiles, got %v and %v", ok.Percentile(50), bad.Percentile(50))
+	}
+}
+
+func TestBenchHTTP_Chain(t *testing.T) {
+	var logins int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := atomic.AddInt64(&logins, 1)
+			fmt.Fprintf(w, `{"token":"t%d"}`, n)
+		case "/me":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer t") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("me"))
+		}
+	}))
+	defer srv.Close()
+
+	flow := RequestTemplate{Name: "auth", Steps: []RequestTemplate{
+		{Name: "login", Method: "POST", URL: "/login", Body: "{}", Extract: map[string]*Extract{"token": {JSON: "$.token"}}},
+		{Name: "me", URL: "/me", Headers: []string{"Authorization: Bearer __VAR_token__"}},
+	}}
+	if err := flow.normalize(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	res := BenchHTTP(BenchParam{ConnNum: 2, Duration: 2 * time.Second, MaxReqs: 200, Scenario: []RequestTemplate{flow}})
+
+	if len(res.Templates) != 2 {
+		t.Fatalf("expected stats for 2 steps, got %d", len(res.Templates))
+	}
+	login, me := res.Templates[0], res.Templates[1]
+	if login.Template.Name != "auth/login" || me.Template.Name != "auth/me" {
+		t.Fatalf("unexpected step names %q, %q", login.Template.Name, me.Template.Name)
+	}
+	if me.Stat.BadCnt != 0 || me.Stat.GoodCnt < 95 {
+		t.Fatalf("expected authorized calls, got good=%d bad=%d", me.Stat.GoodCnt, me.Stat.BadCnt)
+	}
+	if login.Stat.GoodCnt-me.Stat.GoodCnt > 2 {
+		t.Fatalf("expected steps to alternate, got login=%d me=%d", login.Stat.GoodCnt, me.Stat.GoodCnt)
+	}
+	if login.Percentile(50) <= 0 || me.Percentile(50) <= 0 {
+		t.Fatalf("expected per-step latency, got %v and %v", login.Percentile(50), me.Percentile(50))
+	}
+}
+
+func TestBenchHTTP_ChainRedirect(t *testing.T) {
+	var logins int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := atomic.AddInt64(&logins, 1)
+			w.Header().Set("X-Session", fmt.Sprintf("s%d", n))
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/me":
+			if !strings.HasPrefix(r.Header.Get("X-Session"), "s") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("me"))
+		}
+	}))
+	defer srv.Close()
+
+	flow := RequestTemplate{Name: "auth", Steps: []RequestTemplate{
+		{Name: "login", Method: "POST", URL: "/login", Extract: map[string]*Extract{"session": {Header: "X-Session"}}},
+		{Name: "me", URL: "/me", Headers: []string{"X-Session: __VAR_session__"}},
+	}}
+	if err := flow.normalize(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	res := BenchHTTP(BenchParam{ConnNum: 1, Duration: 2 * time.Second, MaxReqs: 20, Scenario: []RequestTemplate{flow}})
+
+	login, me := res.Templates[0], res.Templates[1]
+	if login.Stat.RedirectCnt != 10 || login.Stat.FailedCnt != 0 {
+		t.Fatalf("expected 10 redirected logins, got redirect=%d failed=%d", login.Stat.RedirectCnt, login.Stat.FailedCnt)
+	}
+	if me.Stat.GoodCnt != 10 || me.Stat.BadCnt != 0 {
+		t.Fatalf("expected the sequence to go on after the redirect, got good=%d bad=%d", me.Stat.GoodCnt, me.Stat.BadCnt)
+	}
+}
+
+func TestBenchHTTP_Corpus(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, `{"url": "/"}`, `{"url": "/bad"}`)
+	}
+	corpus, err := OpenCorpus(writeCorpus(t, lines...), mockServerURL, CorpusSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	res := BenchHTTP(BenchParam{ConnNum: 2, Duration: 5 * time.Second, Corpus: corpus})
+
+	if res.Stat.GoodCnt != 20 || res.Stat.BadCnt != 20 {
+		t.Fatalf("expected the corpus to be replayed once, got good=%d bad=%d", res.Stat.GoodCnt, res.Stat.BadCnt)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the run to end with the corpus, took %v", elapsed)
+	}
+}
+
+func TestBenchHTTP_StdinCorpusWithoutWarmup(t *testing.T) {
+	records := strings.Repeat(`{"url": "/"}`+"\n", 5)
+	corpus := &Corpus{baseURL: mockServerURL, order: CorpusSequential}
+	corpus.readStdin(strings.NewReader(records))
+
+	res := BenchHTTP(BenchParam{ConnNum: 1, Duration: 5 * time.Second, WarmupReqs: 3, Corpus: corpus})
+
+	if res.Stat.GoodCnt != 5 {
+		t.Fatalf("expected every stdin record in the measurement, got good=%d", res.Stat.GoodCnt)
+	}
+}
+
+func TestBenchHTTP_StdinCorpusAcrossRuns(t *testing.T) {
+	for _, order := range []CorpusOrder{CorpusSequential, CorpusRandom} {
+		// A slow pipe leaves each run blocked on stdin when it ends; the
+		// next run must take over without a second reader.
+		pr, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 20; i++ {
+				time.Sleep(2 * time.Millisecond)
+				fmt.Fprintf(pw, "{\"url\": \"/%d\"}\n", i)
+			}
+			pw.Close()
+		}()
+		corpus := &Corpus{baseURL: mockServerURL, order: order}
+		corpus.readStdin(pr)
+
+		good := 0
+		for run := 0; run < 5; run++ {
+			good += BenchHTTP(BenchParam{ConnNum: 2, Duration: 10 * time.Millisecond, Corpus: corpus}).Stat.GoodCnt
+		}
+		good += BenchHTTP(BenchParam{ConnNum: 2, Duration: 5 * time.Second, Corpus: corpus}).Stat.GoodCnt
+
+		if good != 20 {
+			t.Fatalf("order %d: expected every record sent once across the runs, got %d", order, good)
+		}
+	}
+}
+
+func TestBenchHTTP_TLSHandshakes(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tlsConfig, err := TLSOptions{InsecureSkipVerify: true, SessionResumption: true}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, http2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http2=%v", http2), func(t *testing.T) {
+			param := BenchParam{
+				URL:       srv.URL,
+				Method:    "GET",
+				ConnNum:   2,
+				Duration:  2 * time.Second,
+				MaxReqs:   20,
+				HTTP2:     http2,
+				TLSConfig: tlsConfig,
+			}
+
+			res := BenchHTTP(param)
+
+			if res.Stat.GoodCnt != 20 {
+				t.Fatalf("expected 20 good responses, got %d (err=%d)", res.Stat.GoodCnt, res.Stat.ErrorCnt)
+			}
+			if res.Stat.HandshakeCnt != 2 {
+				t.Fatalf("expected 2 handshakes, got %d", res.Stat.HandshakeCnt)
+			}
+			if http2 && res.Stat.StreamCnt != 20 {
+				t.Fatalf("expected 20 HTTP/2 streams, got %d", res.Stat.StreamCnt)
+			}
+			if res.Handshake.Latency <= 0 {
+				t.Fatalf("expected handshake latency > 0, got %v", res.Handshake.Latency)
+			}
+		})
+	}
+}
+
+func TestBenchHTTP_ErrorKinds(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := closed.URL
+	closed.Close()
+
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+
+	resetSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer resetSrv.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		kind ErrorKind
+	}{
+		{"timeout", mockServerURL + "/slow", ErrKindTimeout},
+		{"refused", refusedURL, ErrKindRefused},
+		{"reset", resetSrv.URL, ErrKindReset},
+		{"dns", "http://wrkb-does-not-exist.invalid/", ErrKindDNS},
+		{"tls", tlsSrv.URL, ErrKindTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := BenchParam{
+				URL:      tt.url,
+				Method:   "GET",
+				ConnNum:  1,
+				Duration: 5 * time.Second,
+				MaxReqs:  2,
+				Timeout:  10 * time.Millisecond,
+			}
+
+			res := BenchHTTP(param)
+
+			if res.Stat.ErrorCnt != 2 {
+				t.Fatalf("expected 2 errors, got %d (good=%d)", res.Stat.ErrorCnt, res.Stat.GoodCnt)
+			}
+			if got := res.Stat.ErrorKindCnt[tt.kind]; got != 2 {
+				t.Fatalf("expected 2 %s errors, got %v", tt.kind, res.Stat.ErrorKindCnt)
+			}
+		})
+	}
+}
+
+func TestBenchHTTP_FailedChecks(t *testing.T) {
+	checks, err := CheckOptions{Status: "200", BodyContains: "slow-ok"}.Checks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, http2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("h2c=%v", http2), func(t *testing.T) {
+			param := baseParams(1, "/")
+			param.MaxReqs = 10
+			param.Checks = checks
+			param.H2C = http2
+			if http2 {
+				srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = w.Write([]byte("ok"))
+				}))
+				srv.Config.Protocols = new(http.Protocols)
+				srv.Config.Protocols.SetUnencryptedHTTP2(true)
+				srv.Start()
+				defer srv.Close()
+				param.URL = srv.URL
+			}
+
+			res := BenchHTTP(param)
+
+			if res.Stat.FailedCnt != 10 || res.Stat.GoodCnt != 0 || res.Stat.BadCnt != 0 {
+				t.Fatalf("expected 10 failed, got good=%d bad=%d failed=%d err=%d",
+					res.Stat.GoodCnt, res.Stat.BadCnt, res.Stat.FailedCnt, res.Stat.ErrorCnt)
+			}
+			if len(res.Stat.FailReasons) != 1 || res.Stat.FailReasons[0] != `body does not contain "slow-ok"` {
+				t.Fatalf("unexpected fail reasons: %v", res.Stat.FailReasons)
+			}
+		})
+	}
+}
+
 func BenchmarkBenchHTTP(b *testing.B) {
 	connLevels := []int{1, 2, 4, 8}
 
@@ -126,3 +871,27 @@ func BenchmarkBenchHTTP(b *testing.B) {
 		})
 	}
 }
+
+func TestParsePercentiles(t *testing.T) {
+	got, err := ParsePercentiles("99.99, 50,95,75,95,100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[50 75 95 99.99 100]" {
+		t.Errorf("got %v", got)
+	}
+	for _, in := range []string{"", "0", "101", "p99", "50,,99"} {
+		if _, err := ParsePercentiles(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+
+	h := newHistogram()
+	for i := 1; i <= 10000; i++ {
+		_ = h.RecordValue(int64(i) * 1000)
+	}
+	s := calcLatencyStat(h, []float64{75, 99.99})
+	if len(s.Percentiles) != 2 || s.Percentile(75) < 7490*time.Microsecond || s.Percentile(75) > 7510*time.Microsecond || s.Percentile(50) != 0 {
+		t.Errorf("unexpected percentiles %+v", s.Percentiles)
+	}
+}
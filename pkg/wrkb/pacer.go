@@ -0,0 +1,106 @@
+package wrkb
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// pausePoll is how often workers re-check a paused (zero) rate.
+const pausePoll = 10 * time.Millisecond
+
+// pacer hands out send slots at a rate shared by all workers.
+//
+// In closed-loop mode a slot that is already in the past is moved to now, so
+// slow responses reduce the sending rate (the same as a dropped ticker tick).
+// In open-loop mode slots keep their intended send time, which lets workers
+// measure latency from the moment a request should have been sent.
+type pacer struct {
+	mu       sync.Mutex
+	rate     func(t time.Time) float64
+	next     time.Time
+	openLoop bool
+}
+
+func newPacer(rps float64, openLoop bool) *pacer {
+	return &pacer{rate: func(time.Time) float64 { return rps }, openLoop: openLoop}
+}
+
+func rateInterval(rps float64) time.Duration {
+	interval := time.Duration(float64(time.Second) / rps)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	return interval
+}
+
+// wait blocks until the next slot and returns its intended send time.
+func (p *pacer) wait(ctx context.Context) (time.Time, bool) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		if p.next.IsZero() || (!p.openLoop && p.next.Before(now)) {
+			p.next = now
+		}
+
+		slot := p.next
+		rps := p.rate(slot)
+		paused := rps <= 0
+		if paused {
+			slot = now.Add(pausePoll)
+			p.next = slot
+		} else {
+			p.next = p.nextSlot(slot)
+		}
+		p.mu.Unlock()
+
+		if !sleepUntil(ctx, slot) {
+			return slot, false
+		}
+		if !paused {
+			return slot, true
+		}
+	}
+}
+
+// nextSlot returns the slot one request after slot. The rate is integrated
+// in steps of at most pausePoll, so a schedule ramping up from a low rate is
+// not stuck with the long interval of its first slot.
+func (p *pacer) nextSlot(slot time.Time) time.Time {
+	t, credit := slot, 0.0
+	for credit < 1 {
+		rps := p.rate(t)
+		if rps <= 0 {
+			return t
+		}
+		step := min(time.Duration(math.Ceil((1-credit)/rps*float64(time.Second))), pausePoll)
+		step = max(step, time.Nanosecond)
+		credit += rps * step.Seconds()
+		t = t.Add(step)
+	}
+	return t
+}
+
+// missed reports whether a request sent at start fell behind its slot.
+func (p *pacer) missed(slot, start time.Time) bool {
+	rps := p.rate(slot)
+	return rps > 0 && start.Sub(slot) > rateInterval(rps)
+}
+
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	delay := time.Until(t)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,66 +1,140 @@
 package wrkb
 
 import (
-	"crypto/rand"
 	"encoding/hex"
+	"math"
 	mathrand "math/rand"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-func init() {
-	mathrand.Seed(time.Now().UnixNano())
+// substitute replaces the placeholders in s. Requests are rendered from
+// templates compiled once instead; see compileRequest.
+func substitute(s string) string {
+	return substituteKinds(s, kindAll&^kindVar, nil)
 }
 
-func substitute(s string) string {
-	if len(s) == 0 || (!strings.Contains(s, "__RAND") && !strings.Contains(s, "__SEQI64")) {
+func substituteKinds(s string, kinds placeholderKind, vars map[string]string) string {
+	if len(s) == 0 || !strings.Contains(s, "__") {
 		return s
 	}
+	var sub substitution
+	t := compileText(s, kinds, map[string]int{})
+	return sub.render(&t, vars)
+}
 
-	subFns := [...]subFn{subRandI64, subSeqI64, subRandHex, subRandStr}
-
-	for i := range subFns {
-		s = subFns[i](s)
+// newRand returns a generator seeded with seed, or from the clock when seed
+// is 0.
+func newRand(seed int64) *mathrand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
+	return mathrand.New(mathrand.NewSource(seed))
+}
 
-	return s
+// deriveSeed returns the seed of a stream of the run seeded with seed, such
+// as a worker's, so that every stream is independent of the others and of
+// the streams of nearby seeds.
+func deriveSeed(seed int64, stream int) int64 {
+	return int64(splitmix64(splitmix64(uint64(seed)) + uint64(stream)))
 }
 
-type subFn func(string) string
+// splitmix64 is the SplitMix64 finalizer, a bijective bit mixer.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
 
-// RANDI64 — __RANDI64_<low>_<high>__
-var reRandI64 = regexp.MustCompile(`__RANDI64_([+-]?\d{1,19})_([+-]?\d{1,19})__`)
+// parseGenerator returns the generator of a placeholder spec, the text
+// between the underscores without a #name, or nil for unknown specs.
+func parseGenerator(spec string, kinds placeholderKind) generator {
+	kind, args, hasArgs := strings.Cut(spec, "_")
+	switch {
+	case kind == "RANDI64" && kinds&kindRandI64 != 0:
+		if low, high, ok := parseRange(args); ok {
+			return randI64{low: low, high: high}
+		}
+	case kind == "SEQI64" && kinds&kindSeqI64 != 0:
+		if low, high, ok := parseRange(args); ok {
+			return seqI64Gen{key: seqI64Key(low, high), low: low, high: high}
+		}
+	case kind == "RANDHEX" && kinds&kindRandHex != 0:
+		if n, ok := parseLength(args, 3); ok {
+			return randHex{n: n}
+		}
+	case kind == "RANDSTR" && kinds&kindRandStr != 0:
+		charset, length, _ := strings.Cut(args, "_")
+		chars, ok := randStrCharsets[charset]
+		if n, valid := parseLength(length, 5); ok && valid {
+			return randStr{chars: chars, n: n}
+		}
+	case (kind == "UUID4" || kind == "UUID7") && kinds&kindUUID != 0 && !hasArgs:
+		return uuidGen{version: kind[4] - '0'}
+	case kind == "NOW" && kinds&kindNow != 0:
+		return parseNow(args)
+	case kind == "RANDDATE" && kinds&kindRandDate != 0:
+		return parseRandDate(args)
+	case kind == "RANDF64" && kinds&kindRandF64 != 0:
+		return parseRandF64(args)
+	case kinds&kindFake != 0 && !hasArgs:
+		if gen, ok := fakeGenerators[kind]; ok {
+			return gen
+		}
+	}
+	return nil
+}
 
+// RANDI64 — __RANDI64_<low>_<high>__
 func subRandI64(s string) string {
-	return reRandI64.ReplaceAllStringFunc(s, func(match string) string {
-		m := reRandI64.FindStringSubmatch(match)
-		if len(m) != 3 {
-			return match
-		}
+	return substituteKinds(s, kindRandI64, nil)
+}
 
-		low, _ := strconv.ParseInt(m[1], 10, 64)
-		high, _ := strconv.ParseInt(m[2], 10, 64)
-		if high < low {
-			low, high = high, low
+type randI64 struct {
+	low, high int64
+}
+
+func (g randI64) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	span := uint64(g.high - g.low + 1)
+	if span == 0 {
+		// The full int64 range.
+		return strconv.AppendInt(dst, int64(r.Uint64()), 10)
+	}
+	var v uint64
+	if span <= 1<<63-1 {
+		v = uint64(r.Int63n(int64(span)))
+	} else {
+		for v = r.Uint64(); v >= span; v = r.Uint64() {
 		}
-		val := low + mathrand.Int63n(high-low+1)
-		return strconv.FormatInt(val, 10)
-	})
+	}
+	return strconv.AppendInt(dst, g.low+int64(v), 10)
 }
 
 // SEQI64 — __SEQI64_<low>_<high>__
-var reSeqI64 = regexp.MustCompile(`__SEQI64_([+-]?\d{1,19})_([+-]?\d{1,19})__`)
+func subSeqI64(s string) string {
+	return substituteKinds(s, kindSeqI64, nil)
+}
 
 type seqI64State struct {
 	mu   sync.Mutex
 	next map[string]int64
 }
 
+func seqI64Key(low, high int64) string {
+	return strconv.FormatInt(low, 10) + ":" + strconv.FormatInt(high, 10)
+}
+
 func (s *seqI64State) nextVal(low, high int64) int64 {
-	key := strconv.FormatInt(low, 10) + ":" + strconv.FormatInt(high, 10)
+	return s.advance(seqI64Key(low, high), low, high)
+}
+
+// advance returns the next value of the sequence key, shared by all
+// placeholders with the same range. The counters are shared by all workers
+// of unseeded runs; seeded ones use a seqI64Stride per worker instead.
+func (s *seqI64State) advance(key string, low, high int64) int64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -71,7 +145,7 @@ func (s *seqI64State) nextVal(low, high int64) int64 {
 	}
 
 	next := cur + 1
-	if next > high {
+	if next > high || next < cur {
 		next = low
 	}
 	s.next[key] = next
@@ -80,79 +154,330 @@ func (s *seqI64State) nextVal(low, high int64) int64 {
 
 var seqI64 = &seqI64State{next: make(map[string]int64)}
 
-func subSeqI64(s string) string {
-	return reSeqI64.ReplaceAllStringFunc(s, func(match string) string {
-		m := reSeqI64.FindStringSubmatch(match)
-		if len(m) != 3 {
-			return match
-		}
+type seqI64Gen struct {
+	key       string
+	low, high int64
+}
 
-		low, _ := strconv.ParseInt(m[1], 10, 64)
-		high, _ := strconv.ParseInt(m[2], 10, 64)
-		if high < low {
-			low, high = high, low
-		}
+func (g seqI64Gen) appendValue(dst []byte, _ *mathrand.Rand) []byte {
+	return strconv.AppendInt(dst, seqI64.advance(g.key, g.low, g.high), 10)
+}
 
-		val := seqI64.nextVal(low, high)
-		return strconv.FormatInt(val, 10)
-	})
+// seqI64Stride draws the SEQI64 values of one worker of a seeded run: worker
+// w of n takes low+w, low+w+n, ... wrapping within the range, so together
+// the workers walk the range while each sends the same values every run,
+// without a counter shared between them.
+type seqI64Stride struct {
+	worker, workers uint64
+	next            map[string]uint64 // offset from low of the next value
 }
 
-// RANDHEX — __RANDHEX_<len>__
-var reRandHex = regexp.MustCompile(`__RANDHEX_(\d{1,3})__`)
+func newSeqI64Stride(worker, workers int) *seqI64Stride {
+	return &seqI64Stride{worker: uint64(worker), workers: uint64(max(workers, 1)), next: make(map[string]uint64)}
+}
+
+func (s *seqI64Stride) advance(g seqI64Gen) int64 {
+	span := uint64(g.high-g.low) + 1 // 0 for the full int64 range
+	step := s.workers
+	off, ok := s.next[g.key]
+	if !ok {
+		off = s.worker
+	}
+	if span != 0 {
+		step %= span
+		off %= span
+	}
+
+	next := off + step
+	if span != 0 && (next >= span || next < off) {
+		next -= span
+	}
+	s.next[g.key] = next
+	return g.low + int64(off)
+}
 
+// RANDHEX — __RANDHEX_<len>__
 func subRandHex(s string) string {
-	return reRandHex.ReplaceAllStringFunc(s, func(match string) string {
-		m := reRandHex.FindStringSubmatch(match)
-		if len(m) != 2 {
-			return match
-		}
-		length, _ := strconv.Atoi(m[1])
-		if length <= 0 {
-			return match
-		}
+	return substituteKinds(s, kindRandHex, nil)
+}
+
+type randHex struct {
+	n int
+}
+
+const hexDigits = "0123456789abcdef"
 
-		buf := make([]byte, (length+1)/2)
-		if _, err := rand.Read(buf); err != nil {
-			return match
+func (g randHex) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	for n := g.n; n > 0; {
+		v := r.Uint64()
+		for i := 0; i < 16 && n > 0; i, n = i+1, n-1 {
+			dst = append(dst, hexDigits[v&0xf])
+			v >>= 4
 		}
-		return hex.EncodeToString(buf)[:length]
-	})
+	}
+	return dst
 }
 
 // RANDSTR — __RANDSTR_<charset>_<len>__
 // charset: letters, digits, lettersdigits
-var reRandStr = regexp.MustCompile(`__RANDSTR_(letters|digits|lettersdigits)_(\d{1,5})__`)
-
 func subRandStr(s string) string {
-	return reRandStr.ReplaceAllStringFunc(s, func(match string) string {
-		m := reRandStr.FindStringSubmatch(match)
-		if len(m) != 3 {
-			return match
+	return substituteKinds(s, kindRandStr, nil)
+}
+
+var randStrCharsets = map[string]string{
+	"letters":       "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits":        "0123456789",
+	"lettersdigits": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+}
+
+type randStr struct {
+	chars string
+	n     int
+}
+
+func (g randStr) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	for i := 0; i < g.n; i++ {
+		dst = append(dst, g.chars[r.Intn(len(g.chars))])
+	}
+	return dst
+}
+
+// UUID4, UUID7 — __UUID4__, __UUID7__ (RFC 9562)
+type uuidGen struct {
+	version byte
+}
+
+func (g uuidGen) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	var u [16]byte
+	hi, lo := r.Uint64(), r.Uint64()
+	for i := 0; i < 8; i++ {
+		u[i], u[8+i] = byte(hi>>(56-8*i)), byte(lo>>(56-8*i))
+	}
+	if g.version == 7 {
+		ms := uint64(time.Now().UnixMilli())
+		for i := 0; i < 6; i++ {
+			u[i] = byte(ms >> (40 - 8*i))
 		}
+	}
+	u[6] = u[6]&0x0f | g.version<<4
+	u[8] = u[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return append(dst, buf[:]...)
+}
+
+// NOW — __NOW_<s|ms|ns|RFC3339>[_<offset>]__, the current time shifted by an
+// optional signed duration such as -1h or +15m.
+type nowGen struct {
+	unit   string
+	offset time.Duration
+}
+
+func parseNow(args string) generator {
+	unit, offset, hasOffset := strings.Cut(args, "_")
+	g := nowGen{unit: unit}
+	switch unit {
+	case "s", "ms", "ns", "RFC3339":
+	default:
+		return nil
+	}
+	if hasOffset {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return nil
+		}
+		g.offset = d
+	}
+	return g
+}
+
+func (g nowGen) appendValue(dst []byte, _ *mathrand.Rand) []byte {
+	t := time.Now().Add(g.offset)
+	switch g.unit {
+	case "s":
+		return strconv.AppendInt(dst, t.Unix(), 10)
+	case "ms":
+		return strconv.AppendInt(dst, t.UnixMilli(), 10)
+	case "ns":
+		return strconv.AppendInt(dst, t.UnixNano(), 10)
+	default:
+		return t.AppendFormat(dst, time.RFC3339)
+	}
+}
+
+// RANDDATE — __RANDDATE_<from>_<to>__, a random day between two dates
+// (2006-01-02) or a random second between two RFC3339 times, inclusive,
+// formatted like from.
+type randDate struct {
+	from   time.Time
+	span   int64
+	unit   time.Duration
+	layout string
+}
+
+func parseRandDate(args string) generator {
+	from, to, ok := strings.Cut(args, "_")
+	if !ok {
+		return nil
+	}
+	g := randDate{layout: time.DateOnly, unit: 24 * time.Hour}
+	if strings.Contains(from, "T") {
+		g.layout, g.unit = time.RFC3339, time.Second
+	}
+	start, err := time.Parse(g.layout, from)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse(g.layout, to)
+	if err != nil {
+		return nil
+	}
+	if end.Before(start) {
+		start, end = end, start
+	}
+	g.from = start
+	g.span = int64(end.Sub(start)/g.unit) + 1
+	return g
+}
+
+func (g randDate) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	t := g.from.Add(time.Duration(r.Int63n(g.span)) * g.unit)
+	return t.AppendFormat(dst, g.layout)
+}
+
+// RANDF64 — __RANDF64_<low>_<high>[_<precision>]__, a random float in
+// [low, high) with precision decimals (2 by default).
+type randF64 struct {
+	low, high float64
+	precision int
+}
 
-		charset := m[1]
-		length, _ := strconv.Atoi(m[2])
-		if length <= 0 {
-			return match
+func parseRandF64(args string) generator {
+	parts := strings.Split(args, "_")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil
+	}
+	low, err1 := strconv.ParseFloat(parts[0], 64)
+	high, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || math.IsInf(low, 0) || math.IsInf(high, 0) || math.IsNaN(low) || math.IsNaN(high) {
+		return nil
+	}
+	if high < low {
+		low, high = high, low
+	}
+	g := randF64{low: low, high: high, precision: 2}
+	if len(parts) == 3 {
+		if parts[2] == "0" {
+			g.precision = 0
+		} else if p, ok := parseLength(parts[2], 2); ok {
+			g.precision = p
+		} else {
+			return nil
 		}
+	}
+	return g
+}
 
-		var chars string
-		switch charset {
-		case "letters":
-			chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-		case "digits":
-			chars = "0123456789"
-		case "lettersdigits":
-			chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-		default:
-			return match
+func (g randF64) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	v := g.low + r.Float64()*(g.high-g.low)
+	return strconv.AppendFloat(dst, v, 'f', g.precision, 64)
+}
+
+// EMAIL, NAME, FIRSTNAME, LASTNAME, IPV4, IPV6, PHONE — fake data.
+type fakeGen func(dst []byte, r *mathrand.Rand) []byte
+
+func (g fakeGen) appendValue(dst []byte, r *mathrand.Rand) []byte {
+	return g(dst, r)
+}
+
+var fakeGenerators = map[string]generator{
+	"FIRSTNAME": fakeGen(func(dst []byte, r *mathrand.Rand) []byte { return append(dst, pick(r, firstNames)...) }),
+	"LASTNAME":  fakeGen(func(dst []byte, r *mathrand.Rand) []byte { return append(dst, pick(r, lastNames)...) }),
+	"NAME": fakeGen(func(dst []byte, r *mathrand.Rand) []byte {
+		dst = append(dst, pick(r, firstNames)...)
+		dst = append(dst, ' ')
+		return append(dst, pick(r, lastNames)...)
+	}),
+	// first.last<n>@example.{com,net,org}, reserved domains that never
+	// deliver mail.
+	"EMAIL": fakeGen(func(dst []byte, r *mathrand.Rand) []byte {
+		dst = appendLower(dst, pick(r, firstNames))
+		dst = append(dst, '.')
+		dst = appendLower(dst, pick(r, lastNames))
+		dst = strconv.AppendInt(dst, r.Int63n(10000), 10)
+		dst = append(dst, "@example."...)
+		return append(dst, pick(r, emailTLDs)...)
+	}),
+	"IPV4": fakeGen(func(dst []byte, r *mathrand.Rand) []byte {
+		v := r.Uint32()
+		for i := 0; i < 4; i++ {
+			if i > 0 {
+				dst = append(dst, '.')
+			}
+			dst = strconv.AppendUint(dst, uint64(byte(v>>(24-8*i))), 10)
 		}
+		return dst
+	}),
+	"IPV6": fakeGen(func(dst []byte, r *mathrand.Rand) []byte {
+		hi, lo := r.Uint64(), r.Uint64()
+		for i := 0; i < 8; i++ {
+			if i > 0 {
+				dst = append(dst, ':')
+			}
+			v := hi
+			if i >= 4 {
+				v = lo
+			}
+			dst = strconv.AppendUint(dst, v>>(48-16*(i%4))&0xffff, 16)
+		}
+		return dst
+	}),
+	// An E.164 North American number: +1, an area code and a subscriber
+	// number that do not start with 0 or 1.
+	"PHONE": fakeGen(func(dst []byte, r *mathrand.Rand) []byte {
+		dst = append(dst, "+1"...)
+		dst = strconv.AppendInt(dst, 200+r.Int63n(800), 10)
+		dst = strconv.AppendInt(dst, 200+r.Int63n(800), 10)
+		return strconv.AppendInt(dst, 1000+r.Int63n(9000), 10)
+	}),
+}
 
-		b := make([]byte, length)
-		for i := range b {
-			b[i] = chars[mathrand.Intn(len(chars))]
+var (
+	firstNames = []string{
+		"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+		"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Olena", "Andrii", "Oksana", "Taras", "Iryna", "Dmytro",
+		"Sofia", "Mateo", "Yuki", "Aarav", "Fatima", "Liam", "Emma", "Noah",
+	}
+	lastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Taylor", "Moore",
+		"Shevchenko", "Kovalenko", "Bondarenko", "Tkachenko", "Kravchenko", "Melnyk", "Tanaka", "Sato",
+		"Muller", "Schmidt", "Rossi", "Dubois", "Nowak", "Silva", "Kim", "Patel",
+	}
+	emailTLDs = []string{"com", "net", "org"}
+)
+
+func pick(r *mathrand.Rand, list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+func appendLower(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
 		}
-		return string(b)
-	})
+		dst = append(dst, c)
+	}
+	return dst
 }
@@ -2,10 +2,13 @@ package wrkb
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func resetSeqI64() {
@@ -51,6 +54,34 @@ func TestSubSeqI64_MultipleInString(t *testing.T) {
 	}
 }
 
+func TestSeqI64Stride(t *testing.T) {
+	resetSeqI64()
+	tmpl := compileText("__SEQI64_1_5__ __SEQI64_1_5#id__ __SEQI64_1_5#id__", kindAll, map[string]int{})
+	want := [][]string{
+		{"1 4 4", "2 5 5", "3 1 1"},
+		{"2 5 5", "3 1 1", "4 2 2"},
+		{"3 1 1", "4 2 2", "5 3 3"},
+	}
+	for w, renders := range want {
+		sub := substitution{seq: newSeqI64Stride(w, 3)}
+		for i, want := range renders {
+			sub.reset()
+			if got := sub.render(&tmpl, nil); got != want {
+				t.Fatalf("worker %d, request %d: got %q, want %q", w, i, got, want)
+			}
+		}
+	}
+	if len(seqI64.next) != 0 {
+		t.Fatalf("expected the shared counters to be left alone, got %v", seqI64.next)
+	}
+
+	full := seqI64Gen{key: "full", low: math.MinInt64, high: math.MaxInt64}
+	s := newSeqI64Stride(1, 2)
+	if a, b := s.advance(full), s.advance(full); a != math.MinInt64+1 || b != math.MinInt64+3 {
+		t.Fatalf("unexpected full range values %d, %d", a, b)
+	}
+}
+
 func TestSubRandHex_LengthAndFormat(t *testing.T) {
 	for _, n := range []int{1, 8, 15, 32, 63} {
 		in := fmt.Sprintf("__RANDHEX_%d__", n)
@@ -113,8 +144,209 @@ func TestSubstitute_NoPattern(t *testing.T) {
 	}
 }
 
+func TestSubstitution_Named(t *testing.T) {
+	tmpl := RequestTemplate{
+		URL:     "/orders/__RANDI64_1_1000000000#id__?n=__RANDI64_1_1000000000__",
+		Headers: []string{"X-Order-ID: __RANDI64_1_1000000000#id__-__RANDI64_1_1000000000#other__"},
+		Body:    "__RANDHEX_8#x__ __RANDHEX_8#x__ no placeholders #here__",
+	}
+	var sub substitution
+	req := tmpl.render(&sub, nil)
+
+	id := strings.TrimPrefix(strings.Split(req.URL, "?")[0], "/orders/")
+	if _, err := strconv.Atoi(id); err != nil {
+		t.Fatalf("named placeholder not substituted: %q", req.URL)
+	}
+	parts := strings.Split(strings.TrimPrefix(req.Headers[0], "X-Order-ID: "), "-")
+	if parts[0] != id {
+		t.Fatalf("expected the same value for #id in url and header, got %q and %q", req.URL, req.Headers[0])
+	}
+	if parts[1] == id {
+		t.Errorf("expected #other to be generated independently, got %q", req.Headers[0])
+	}
+	if got := req.Body; len(got) != 41 || got[:8] != got[9:17] || got[17:] != " no placeholders #here__" {
+		t.Errorf("expected two equal hex values, got %q", got)
+	}
+
+	if again := tmpl.render(&sub, nil); strings.HasPrefix(again.URL, "/orders/"+id+"?") {
+		t.Errorf("expected a new value for #id in the next request, got %s again", again.URL)
+	}
+}
+
+func TestSubstitute_UUIDs(t *testing.T) {
+	reUUID := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	v4 := substitute("__UUID4__")
+	if m := reUUID.FindStringSubmatch(v4); m == nil || m[1] != "4" {
+		t.Errorf("invalid UUIDv4 %q", v4)
+	}
+	if other := substitute("__UUID4__"); other == v4 {
+		t.Errorf("expected unique UUIDs, got %s twice", v4)
+	}
+
+	before := time.Now().UnixMilli()
+	v7 := substitute("__UUID7__")
+	if m := reUUID.FindStringSubmatch(v7); m == nil || m[1] != "7" {
+		t.Fatalf("invalid UUIDv7 %q", v7)
+	}
+	ms, _ := strconv.ParseInt(strings.ReplaceAll(v7[:13], "-", ""), 16, 64)
+	if ms < before || ms > time.Now().UnixMilli() {
+		t.Errorf("UUIDv7 %s has timestamp %d, want about %d", v7, ms, before)
+	}
+}
+
+func TestSubstitute_Now(t *testing.T) {
+	now := time.Now()
+	parse := func(s string) int64 {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			t.Fatalf("expected a number, got %q", s)
+		}
+		return n
+	}
+
+	if s := parse(substitute("__NOW_s__")); s < now.Unix() || s > now.Unix()+1 {
+		t.Errorf("NOW_s = %d, want %d", s, now.Unix())
+	}
+	if ms := parse(substitute("__NOW_ms__")); ms < now.UnixMilli() || ms > now.UnixMilli()+1000 {
+		t.Errorf("NOW_ms = %d, want %d", ms, now.UnixMilli())
+	}
+	if ns := parse(substitute("__NOW_ns__")); ns < now.UnixNano() {
+		t.Errorf("NOW_ns = %d, want >= %d", ns, now.UnixNano())
+	}
+	if s := parse(substitute("__NOW_s_-1h__")); s < now.Unix()-3600 || s > now.Unix()-3599 {
+		t.Errorf("NOW_s_-1h = %d, want %d", s, now.Unix()-3600)
+	}
+
+	ts, err := time.Parse(time.RFC3339, substitute("__NOW_RFC3339_+90m__"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ts.Sub(now); d < 89*time.Minute || d > 91*time.Minute {
+		t.Errorf("NOW_RFC3339_+90m is %v from now", d)
+	}
+}
+
+func TestSubstitute_RandDateAndFloat(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		d, err := time.Parse(time.DateOnly, substitute("__RANDDATE_2024-12-31_2024-12-01__"))
+		if err != nil || d.Month() != time.December || d.Year() != 2024 {
+			t.Fatalf("RANDDATE out of range: %v %v", d, err)
+		}
+
+		ts := substitute("__RANDDATE_2024-01-01T10:00:00+02:00_2024-01-01T10:00:59+02:00__")
+		if !regexp.MustCompile(`^2024-01-01T10:00:[0-5]\d\+02:00$`).MatchString(ts) {
+			t.Fatalf("RANDDATE time out of range: %q", ts)
+		}
+
+		f := substitute("__RANDF64_-1.5_2.5_3__")
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v < -1.5 || v > 2.5 || len(f[strings.IndexByte(f, '.')+1:]) != 3 {
+			t.Fatalf("RANDF64 out of range or precision: %q", f)
+		}
+	}
+	if f := substitute("__RANDF64_0_1__"); len(f) != 4 {
+		t.Errorf("expected 2 decimals by default, got %q", f)
+	}
+}
+
+func TestSubstitute_FakeData(t *testing.T) {
+	checks := map[string]*regexp.Regexp{
+		"__EMAIL__":     regexp.MustCompile(`^[a-z]+\.[a-z]+\d{1,4}@example\.(com|net|org)$`),
+		"__NAME__":      regexp.MustCompile(`^[A-Z][a-z]+ [A-Z][a-z]+$`),
+		"__FIRSTNAME__": regexp.MustCompile(`^[A-Z][a-z]+$`),
+		"__LASTNAME__":  regexp.MustCompile(`^[A-Z][a-z]+$`),
+		"__PHONE__":     regexp.MustCompile(`^\+1[2-9]\d{2}[2-9]\d{6}$`),
+	}
+	for i := 0; i < 100; i++ {
+		for in, re := range checks {
+			if out := substitute(in); !re.MatchString(out) {
+				t.Fatalf("%s: unexpected %q", in, out)
+			}
+		}
+
+		if ip := net.ParseIP(substitute("__IPV4__")); ip == nil || ip.To4() == nil {
+			t.Fatalf("invalid IPv4")
+		}
+		v6 := substitute("__IPV6__")
+		if ip := net.ParseIP(v6); ip == nil || strings.Count(v6, ":") != 7 {
+			t.Fatalf("invalid IPv6 %q", v6)
+		}
+	}
+}
+
+func TestSubstitute_InvalidNewPlaceholders(t *testing.T) {
+	for _, in := range []string{
+		"__UUID4_x__", "__UUID5__", "__NOW__", "__NOW_h__", "__NOW_s_soon__",
+		"__RANDDATE_2024-13-01_2024-01-01__", "__RANDDATE_2024-01-01__",
+		"__RANDF64_a_1__", "__RANDF64_0_1_x__", "__RANDF64_0_1_100__", "__EMAIL_x__", "__init__",
+	} {
+		if out := substitute(in); out != in {
+			t.Errorf("%s: expected no substitution, got %q", in, out)
+		}
+	}
+}
+
+func TestSubstitution_Seed(t *testing.T) {
+	tmpl := RequestTemplate{
+		URL:     "/u/__RANDI64_1_1000000__/__RANDSTR_letters_8__",
+		Headers: []string{"X-Id: __UUID4__"},
+		Body:    `{"email":"__EMAIL__","amount":__RANDF64_1_100__,"day":"__RANDDATE_2024-01-01_2024-12-31__"}`,
+	}
+	stream := func(seed int64) []string {
+		sub := substitution{rng: newRand(seed)}
+		var out []string
+		for i := 0; i < 5; i++ {
+			req := tmpl.render(&sub, nil)
+			out = append(out, req.URL+" "+req.Headers[0]+" "+req.Body)
+		}
+		return out
+	}
+
+	w0, w1 := deriveSeed(42, 0), deriveSeed(42, 1)
+	if a, b := stream(w0), stream(w0); fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Fatalf("same seed, different values:\n%v\n%v", a, b)
+	}
+	if a, b := stream(w0), stream(w1); a[0] == b[0] {
+		t.Errorf("workers 0 and 1 got the same value %q", a[0])
+	}
+	if deriveSeed(42, 1) == deriveSeed(43, 0) {
+		t.Errorf("streams of nearby seeds collide")
+	}
+
+	p := newTemplatePicker([]RequestTemplate{{Weight: 1}, {Weight: 1}, {Weight: 1}})
+	r1, r2 := newRand(7), newRand(7)
+	for i := 0; i < 100; i++ {
+		if a, b := p.pick(r1), p.pick(r2); a != b {
+			t.Fatalf("pick %d: got %d and %d from the same seed", i, a, b)
+		}
+	}
+}
+
+func TestCompileText(t *testing.T) {
+	tests := []struct {
+		in       string
+		segments int
+	}{
+		{"https://example.com/static/path", 0},
+		{"__RANDI64_1_9__", 1},
+		{"a__RANDI64_1_9__b", 3},
+		{"___RANDHEX_4__", 2},
+		{"__RANDHEX_0__ __RANDHEX_1000__ __RANDSTR_emoji_4__ __RANDI64_1__ __SEQI64_a_b__", 0},
+		{"__RANDI64_1_9#__ __RANDI64_1_9#a-b__", 0},
+		{"__VAR_token__ __RANDHEX_4#x__", 3},
+	}
+	for _, tt := range tests {
+		tmpl := compileText(tt.in, kindAll, map[string]int{})
+		if len(tmpl.segments) != tt.segments {
+			t.Errorf("%q: got %d segments, want %d", tt.in, len(tmpl.segments), tt.segments)
+		}
+	}
+}
+
 func BenchmarkSubRandI64(b *testing.B) {
 	input := "__RANDI64_1000_9999__"
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_ = subRandI64(input)
 	}
@@ -122,6 +354,7 @@ func BenchmarkSubRandI64(b *testing.B) {
 
 func BenchmarkSubRandHex(b *testing.B) {
 	input := "__RANDHEX_64__"
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_ = subRandHex(input)
 	}
@@ -129,6 +362,7 @@ func BenchmarkSubRandHex(b *testing.B) {
 
 func BenchmarkSubRandStr(b *testing.B) {
 	input := "__RANDSTR_lettersdigits_32__"
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_ = subRandStr(input)
 	}
@@ -136,7 +370,57 @@ func BenchmarkSubRandStr(b *testing.B) {
 
 func BenchmarkSubstitute_Combined(b *testing.B) {
 	input := "http://localhost:8080/messages?from=__RANDI64_700_777__&to=__RANDI64_380670000001_380670099999__&text=__RANDSTR_lettersdigits_16__&token=__RANDHEX_8__"
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_ = substitute(input)
 	}
 }
+
+func BenchmarkRender_Static(b *testing.B) {
+	tmpl := RequestTemplate{Method: "GET", URL: "http://localhost:8080/health", Headers: []string{"Accept: */*"}}
+	var sub substitution
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = tmpl.render(&sub, nil)
+	}
+}
+
+func BenchmarkRender_URL(b *testing.B) {
+	tmpl := RequestTemplate{
+		Method: "GET",
+		URL:    "http://localhost:8080/messages?from=__RANDI64_700_777__&to=__RANDI64_380670000001_380670099999__&text=__RANDSTR_lettersdigits_16__&token=__RANDHEX_8__",
+	}
+	var sub substitution
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = tmpl.render(&sub, nil)
+	}
+}
+
+func BenchmarkRender_Request(b *testing.B) {
+	tmpl := RequestTemplate{
+		Method:  "PUT",
+		URL:     "http://localhost:8080/subscribers/__SEQI64_380500000000_380509999999#msisdn__",
+		Headers: []string{"Authorization: Bearer eyJ4NXQi", "X-Request-ID: __RANDHEX_16__"},
+		Body:    `{"msisdn": __SEQI64_380500000000_380509999999#msisdn__, "billing_type": __RANDI64_0_2__, "language_type": __RANDI64_0_2__}`,
+	}
+	vars := map[string]string{"token": "abc"}
+	var sub substitution
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = tmpl.render(&sub, vars)
+	}
+}
+
+func BenchmarkRender_FakeData(b *testing.B) {
+	tmpl := RequestTemplate{
+		Method: "POST",
+		URL:    "http://localhost:8080/users/__UUID7__",
+		Body:   `{"id":"__UUID4__","name":"__NAME__","email":"__EMAIL__","ip":"__IPV4__","phone":"__PHONE__","at":"__NOW_RFC3339__","score":__RANDF64_0_100_2__}`,
+	}
+	var sub substitution
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = tmpl.render(&sub, nil)
+	}
+}
@@ -0,0 +1,183 @@
+package wrkb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Sample is the load observed during one sampling interval of a run.
+type Sample struct {
+	// Offset is the end of the interval, measured from the start of the run.
+	Offset time.Duration
+	// Duration is the interval length; the last interval may be shorter.
+	Duration time.Duration
+	RPS      int
+	Good     int
+	Redirect int
+	Bad      int
+	Failed   int
+	Error    int
+	// LatencyStat holds the latencies of the interval at the run's
+	// percentiles.
+	LatencyStat
+
+	// histogram and corrected are copies of the interval's histograms, kept
+	// for the --hlog time series.
+	histogram *hdrhistogram.Histogram
+	corrected *hdrhistogram.Histogram
+}
+
+// sampler cuts a run into fixed intervals. Every worker records into its own
+// window, so the lock is only contended when the sampler collects.
+type sampler struct {
+	interval       time.Duration
+	percentiles    []float64
+	keepHistograms bool
+	start          time.Time
+	last           time.Time
+	windows        []*sampleWindow
+	total          BenchStat
+	samples        []Sample
+}
+
+type sampleWindow struct {
+	mu   sync.Mutex
+	stat BenchStat
+}
+
+// newSampler samples a run of param with workers. With openLoop the samples
+// also record the latencies from the send slots.
+func newSampler(param BenchParam, openLoop bool, workers int, start time.Time) *sampler {
+	s := &sampler{
+		interval:       param.SampleInterval,
+		percentiles:    param.percentiles(),
+		keepHistograms: param.HlogPath != "",
+		start:          start,
+		last:           start,
+		windows:        make([]*sampleWindow, workers),
+		total:          newSampleStat(openLoop),
+	}
+	for i := range s.windows {
+		s.windows[i] = &sampleWindow{stat: newSampleStat(openLoop)}
+	}
+	return s
+}
+
+// newSampleStat is newStageStat without the status breakdown, which samples
+// do not report.
+func newSampleStat(openLoop bool) BenchStat {
+	stat := BenchStat{Histogram: newHistogram()}
+	if openLoop {
+		stat.CorrectedHistogram = newCorrectedHistogram()
+	}
+	return stat
+}
+
+// add records a request; slot is its send slot when the correction applies.
+func (w *sampleWindow) add(out Outcome, failReason string, slot time.Time) {
+	w.mu.Lock()
+	recordOutcome(&w.stat, out, failReason)
+	if w.stat.CorrectedHistogram != nil && out.Err == nil {
+		w.stat.CorrectedHistogram.RecordValue(out.End.Sub(slot).Nanoseconds())
+	}
+	w.mu.Unlock()
+}
+
+// resetSampleStat clears stat, keeping its histograms for reuse.
+func resetSampleStat(stat *BenchStat) {
+	stat.Histogram.Reset()
+	if stat.CorrectedHistogram != nil {
+		stat.CorrectedHistogram.Reset()
+	}
+	*stat = BenchStat{Histogram: stat.Histogram, CorrectedHistogram: stat.CorrectedHistogram}
+}
+
+func copyHistogram(h *hdrhistogram.Histogram) *hdrhistogram.Histogram {
+	if h == nil {
+		return nil
+	}
+	return hdrhistogram.Import(h.Export())
+}
+
+// run collects a sample every interval until ctx is done.
+func (s *sampler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.collect(now, false)
+		}
+	}
+}
+
+// collect closes the interval ending at now. The final call folds requests
+// that were still in flight when the run ended into the last sample rather
+// than reporting them as a sample a few milliseconds long.
+func (s *sampler) collect(now time.Time, final bool) {
+	from := s.last
+	total := &s.total
+	if n := len(s.samples); final && n > 0 && now.Sub(s.last) < s.interval/10 {
+		last := s.samples[n-1]
+		from = s.start.Add(last.Offset - last.Duration)
+		s.samples = s.samples[:n-1]
+	} else {
+		resetSampleStat(total)
+	}
+
+	for _, w := range s.windows {
+		w.mu.Lock()
+		total.GoodCnt += w.stat.GoodCnt
+		total.RedirectCnt += w.stat.RedirectCnt
+		total.BadCnt += w.stat.BadCnt
+		total.FailedCnt += w.stat.FailedCnt
+		total.ErrorCnt += w.stat.ErrorCnt
+		total.Histogram.Merge(w.stat.Histogram)
+		if total.CorrectedHistogram != nil {
+			total.CorrectedHistogram.Merge(w.stat.CorrectedHistogram)
+		}
+		resetSampleStat(&w.stat)
+		w.mu.Unlock()
+	}
+	s.last = now
+
+	requests := total.requests()
+	d := now.Sub(from)
+	if d <= 0 || (requests == 0 && d < s.interval) {
+		return
+	}
+
+	sample := Sample{
+		Offset:      now.Sub(s.start),
+		Duration:    d,
+		RPS:         int(float64(requests) / d.Seconds()),
+		Good:        total.GoodCnt,
+		Redirect:    total.RedirectCnt,
+		Bad:         total.BadCnt,
+		Failed:      total.FailedCnt,
+		Error:       total.ErrorCnt,
+		LatencyStat: calcLatencyStat(total.Histogram, s.percentiles),
+	}
+	if s.keepHistograms {
+		sample.histogram = copyHistogram(total.Histogram)
+		sample.corrected = copyHistogram(total.CorrectedHistogram)
+	}
+	s.samples = append(s.samples, sample)
+}
+
+// samplesBetween returns the samples that started within [from, to).
+func samplesBetween(samples []Sample, from, to time.Duration) []Sample {
+	var out []Sample
+	for _, s := range samples {
+		if start := s.Offset - s.Duration; start >= from && start < to {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+package wrkb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RequestTemplate is one weighted request of a scenario. Method, URL, Headers
+// and Body may contain the placeholders handled by substitute, and the
+// __VAR_<name>__ variables bound by Extract.
+//
+// A template with Steps is a sequence instead: a worker that picks it sends
+// the steps in order, one per iteration, and stops early when a step errors,
+// gets a 4xx/5xx or fails a check or an extraction.
+type RequestTemplate struct {
+	Name    string              `json:"name,omitempty"`
+	Weight  int                 `json:"weight,omitempty"`
+	Method  string              `json:"method,omitempty"`
+	URL     string              `json:"url,omitempty"`
+	Headers []string            `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+	Extract map[string]*Extract `json:"extract,omitempty"`
+	Steps   []RequestTemplate   `json:"steps,omitempty"`
+
+	extractors []extractor
+	rawBody    bool
+	compiled   *compiledRequest
+}
+
+type scenarioFile struct {
+	Requests []RequestTemplate `json:"requests"`
+}
+
+// LoadScenario reads a JSON scenario file:
+//
+//	{"requests": [
+//	  {"name": "items", "weight": 70, "url": "/items/__RANDI64_1_1000__"},
+//	  {"name": "order", "weight": 20, "method": "POST", "url": "/orders", "body": "{\"id\":\"__RANDHEX_8__\"}"},
+//	  {"weight": 10, "method": "DELETE", "url": "/items/__RANDI64_1_1000__"}
+//	]}
+//
+// URLs starting with "/" are resolved against baseURL. Method defaults to GET,
+// weight to 1 and name to "<method> <url>". A sequence is written as
+//
+//	{"name": "login", "steps": [
+//	  {"method": "POST", "url": "/login", "body": "{}", "extract": {"token": {"json": "$.token"}}},
+//	  {"url": "/me", "headers": ["Authorization: Bearer __VAR_token__"]}
+//	]}
+func LoadScenario(path, baseURL string) ([]RequestTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file scenarioFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	if len(file.Requests) == 0 {
+		return nil, fmt.Errorf("invalid scenario %s: no requests", path)
+	}
+
+	for i := range file.Requests {
+		if err := file.Requests[i].normalize(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid scenario %s: request %d: %w", path, i+1, err)
+		}
+	}
+	return file.Requests, nil
+}
+
+func (t *RequestTemplate) normalize(baseURL string) error {
+	if len(t.Steps) > 0 {
+		return t.normalizeSequence(baseURL)
+	}
+
+	switch {
+	case t.URL == "":
+		return fmt.Errorf("missing url")
+	case t.Weight < 0:
+		return fmt.Errorf("negative weight %d", t.Weight)
+	case strings.HasPrefix(t.URL, "/"):
+		if baseURL == "" {
+			return fmt.Errorf("relative url %s needs a base URL argument", t.URL)
+		}
+		t.URL = strings.TrimRight(baseURL, "/") + t.URL
+	}
+
+	if t.Weight == 0 {
+		t.Weight = 1
+	}
+	t.Method = strings.ToUpper(t.Method)
+	if t.Method == "" {
+		t.Method = "GET"
+	}
+	if t.Name == "" {
+		t.Name = t.Method + " " + t.URL
+	}
+	return t.compileExtract()
+}
+
+func (t *RequestTemplate) normalizeSequence(baseURL string) error {
+	switch {
+	case t.URL != "" || t.Body != "" || len(t.Headers) > 0 || len(t.Extract) > 0:
+		return fmt.Errorf("a request with steps cannot have its own url, headers, body or extract")
+	case t.Weight < 0:
+		return fmt.Errorf("negative weight %d", t.Weight)
+	}
+
+	if t.Weight == 0 {
+		t.Weight = 1
+	}
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		if len(step.Steps) > 0 {
+			return fmt.Errorf("step %d: steps cannot be nested", i+1)
+		}
+		if err := step.normalize(baseURL); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	if t.Name == "" {
+		t.Name = t.Steps[0].Name
+	}
+	return nil
+}
+
+// flattenTemplates lists the requests of the templates: a template stands for
+// itself, a sequence for its steps named "<sequence>/<step>". first holds the
+// index of every template's first request.
+func flattenTemplates(templates []RequestTemplate) (requests []RequestTemplate, first []int) {
+	for _, t := range templates {
+		first = append(first, len(requests))
+		if len(t.Steps) == 0 {
+			requests = append(requests, t)
+			continue
+		}
+		for _, step := range t.Steps {
+			step.Name = t.Name + "/" + step.Name
+			step.Weight = t.Weight
+			requests = append(requests, step)
+		}
+	}
+	return requests, first
+}
+
+// templatePicker draws templates in proportion to their weights.
+type templatePicker struct {
+	templates  []RequestTemplate
+	cumulative []int
+	requests   []RequestTemplate
+	first      []int
+}
+
+func newTemplatePicker(templates []RequestTemplate) *templatePicker {
+	p := &templatePicker{templates: templates}
+	p.requests, p.first = flattenTemplates(templates)
+	for i := range p.requests {
+		p.requests[i].compiled = compileRequest(&p.requests[i])
+	}
+	total := 0
+	for _, t := range templates {
+		total += max(t.Weight, 1)
+		p.cumulative = append(p.cumulative, total)
+	}
+	return p
+}
+
+// pick draws a template index from r.
+func (p *templatePicker) pick(r *rand.Rand) int {
+	if len(p.templates) == 1 {
+		return 0
+	}
+	n := r.Intn(p.cumulative[len(p.cumulative)-1])
+	return sort.SearchInts(p.cumulative, n+1)
+}
+
+// TemplateResult is the share of one scenario template, or one step of a
+// sequence, in a BenchResult.
+type TemplateResult struct {
+	Template RequestTemplate
+	Stat     BenchStat
+	RPS      int
+	LatencyStat
+}
+
+// templateResults splits the result's RPS by the templates' request counts.
+// Templates sharing a name are reported together, with their weights summed,
+// in the order the name first appears.
+func templateResults(r BenchResult, templates []RequestTemplate, stats []BenchStat) []TemplateResult {
+	var names []RequestTemplate
+	grouped := map[string]*BenchStat{}
+	for i, t := range templates {
+		s, ok := grouped[t.Name]
+		if !ok {
+			s = &BenchStat{Histogram: newHistogram()}
+			grouped[t.Name] = s
+			names = append(names, t)
+		} else {
+			for j := range names {
+				if names[j].Name == t.Name {
+					names[j].Weight += t.Weight
+				}
+			}
+		}
+		*s = s.Add(stats[i])
+	}
+
+	total := r.Stat.requests()
+	var results []TemplateResult
+	for _, t := range names {
+		s := *grouped[t.Name]
+		tr := TemplateResult{Template: t, Stat: s, LatencyStat: calcLatencyStat(s.Histogram, r.Param.percentiles())}
+		if total > 0 {
+			tr.RPS = int(float64(r.RPS) * float64(s.requests()) / float64(total))
+		}
+		results = append(results, tr)
+	}
+	return results
+}
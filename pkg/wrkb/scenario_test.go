@@ -0,0 +1,100 @@
+package wrkb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeScenario(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := writeScenario(t, `{"requests": [
+		{"name": "items", "weight": 7, "url": "/items/__RANDI64_1_9__"},
+		{"method": "post", "url": "http://other:8080/orders", "headers": ["X-A: 1"], "body": "{}"}
+	]}`)
+
+	templates, err := LoadScenario(path, "http://127.0.0.1:8082/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RequestTemplate{
+		{Name: "items", Weight: 7, Method: "GET", URL: "http://127.0.0.1:8082/items/__RANDI64_1_9__"},
+		{Name: "POST http://other:8080/orders", Weight: 1, Method: "POST", URL: "http://other:8080/orders", Headers: []string{"X-A: 1"}, Body: "{}"},
+	}
+	for i := range want {
+		got := templates[i]
+		if got.Name != want[i].Name || got.Weight != want[i].Weight || got.Method != want[i].Method ||
+			got.URL != want[i].URL || got.Body != want[i].Body || len(got.Headers) != len(want[i].Headers) {
+			t.Errorf("template %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestLoadScenario_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		baseURL string
+	}{
+		{"invalid json", `{"requests": [`, ""},
+		{"empty", `{"requests": []}`, ""},
+		{"missing url", `{"requests": [{"weight": 1}]}`, ""},
+		{"negative weight", `{"requests": [{"url": "http://a/", "weight": -1}]}`, ""},
+		{"relative without base", `{"requests": [{"url": "/a"}]}`, ""},
+	}
+	for _, tt := range tests {
+		if _, err := LoadScenario(writeScenario(t, tt.data), tt.baseURL); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestTemplatePicker(t *testing.T) {
+	p := newTemplatePicker([]RequestTemplate{{Weight: 7}, {Weight: 2}, {Weight: 1}})
+	r := newRand(1)
+	counts := make([]int, 3)
+	for i := 0; i < 10000; i++ {
+		counts[p.pick(r)]++
+	}
+
+	for i, want := range []int{7000, 2000, 1000} {
+		if counts[i] < want*8/10 || counts[i] > want*12/10 {
+			t.Errorf("template %d: picked %d times, want about %d", i, counts[i], want)
+		}
+	}
+}
+
+func TestTemplateResults_GroupsByName(t *testing.T) {
+	stat := func(good int, latency time.Duration) BenchStat {
+		s := BenchStat{GoodCnt: good, Histogram: newHistogram()}
+		for i := 0; i < good; i++ {
+			_ = s.Histogram.RecordValue(latency.Nanoseconds())
+		}
+		return s
+	}
+	templates := []RequestTemplate{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}, {Name: "a", Weight: 2}}
+	stats := []BenchStat{stat(10, time.Millisecond), stat(20, time.Millisecond), stat(10, 3*time.Millisecond)}
+	r := BenchResult{RPS: 400, Stat: BenchStat{GoodCnt: 40}}
+
+	results := templateResults(r, templates, stats)
+	if len(results) != 2 || results[0].Template.Name != "a" || results[1].Template.Name != "b" {
+		t.Fatalf("unexpected groups: %+v", results)
+	}
+	a := results[0]
+	if a.Stat.GoodCnt != 20 || a.Template.Weight != 3 || a.RPS != 200 || a.Max < 2*time.Millisecond {
+		t.Errorf("unexpected group a: good=%d weight=%d rps=%d max=%v", a.Stat.GoodCnt, a.Template.Weight, a.RPS, a.Max)
+	}
+	if stats[0].Histogram.TotalCount() != 10 {
+		t.Errorf("grouping must not modify the template stats")
+	}
+}
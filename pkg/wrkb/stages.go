@@ -0,0 +1,138 @@
+package wrkb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage is one step of a staged load profile. Conns and RPS are the targets
+// reached at the end of the stage, ramping linearly from the previous stage;
+// a negative value keeps the previous target.
+type Stage struct {
+	Duration time.Duration
+	Conns    int
+	RPS      float64
+}
+
+// ParseStage parses "<duration>[:c=<conns>][:rps=<rate>]", e.g. "30s:rps=500"
+// or "2m:c=64:rps=2000".
+func ParseStage(s string) (Stage, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	d, err := time.ParseDuration(parts[0])
+	if err != nil || d <= 0 {
+		return Stage{}, fmt.Errorf("invalid stage %q: bad duration %q", s, parts[0])
+	}
+
+	stage := Stage{Duration: d, Conns: -1, RPS: -1}
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Stage{}, fmt.Errorf("invalid stage %q: expected key=value, got %q", s, part)
+		}
+		switch key {
+		case "c", "conns":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Stage{}, fmt.Errorf("invalid stage %q: bad conns %q", s, value)
+			}
+			stage.Conns = n
+		case "rps":
+			r, err := strconv.ParseFloat(value, 64)
+			if err != nil || r < 0 {
+				return Stage{}, fmt.Errorf("invalid stage %q: bad rps %q", s, value)
+			}
+			stage.RPS = r
+		default:
+			return Stage{}, fmt.Errorf("invalid stage %q: unknown key %q", s, key)
+		}
+	}
+	return stage, nil
+}
+
+func (s Stage) String() string {
+	label := s.Duration.String()
+	if s.Conns >= 0 {
+		label += " c=" + strconv.Itoa(s.Conns)
+	}
+	if s.RPS >= 0 {
+		label += " rps=" + strconv.FormatFloat(s.RPS, 'f', -1, 64)
+	}
+	return label
+}
+
+type stageTarget struct {
+	conns int
+	rps   float64
+}
+
+// loadProfile resolves stages into absolute targets and answers what the
+// load should look like at a given moment of the run.
+type loadProfile struct {
+	start   time.Time
+	stages  []Stage
+	from    []stageTarget
+	to      []stageTarget
+	limited bool
+}
+
+func newLoadProfile(param BenchParam, start time.Time) *loadProfile {
+	p := &loadProfile{start: start, stages: param.Stages, limited: param.RPSLimit > 0}
+
+	prev := stageTarget{conns: param.ConnNum, rps: param.RPSLimit}
+	for _, s := range param.Stages {
+		next := prev
+		if s.Conns >= 0 {
+			next.conns = s.Conns
+		}
+		if s.RPS >= 0 {
+			next.rps = s.RPS
+			p.limited = true
+		}
+		p.from = append(p.from, prev)
+		p.to = append(p.to, next)
+		prev = next
+	}
+	return p
+}
+
+func (p *loadProfile) duration() time.Duration {
+	var total time.Duration
+	for _, s := range p.stages {
+		total += s.Duration
+	}
+	return total
+}
+
+func (p *loadProfile) maxConns() int {
+	n := 0
+	for i := range p.stages {
+		n = max(n, p.from[i].conns, p.to[i].conns)
+	}
+	return n
+}
+
+// at returns the stage index and the interpolated targets at t.
+func (p *loadProfile) at(t time.Time) (int, stageTarget) {
+	elapsed := t.Sub(p.start)
+	for i, s := range p.stages {
+		if elapsed < s.Duration {
+			frac := float64(elapsed) / float64(s.Duration)
+			from, to := p.from[i], p.to[i]
+			return i, stageTarget{
+				conns: from.conns + int(math.Round(float64(to.conns-from.conns)*frac)),
+				rps:   from.rps + (to.rps-from.rps)*frac,
+			}
+		}
+		elapsed -= s.Duration
+	}
+	last := len(p.stages) - 1
+	return last, p.to[last]
+}
+
+func (p *loadProfile) rate(t time.Time) float64 {
+	_, target := p.at(t)
+	return target.rps
+}
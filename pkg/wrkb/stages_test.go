@@ -0,0 +1,67 @@
+package wrkb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Stage
+	}{
+		{"30s", Stage{Duration: 30 * time.Second, Conns: -1, RPS: -1}},
+		{"30s:rps=500", Stage{Duration: 30 * time.Second, Conns: -1, RPS: 500}},
+		{"2m:c=64:rps=2000", Stage{Duration: 2 * time.Minute, Conns: 64, RPS: 2000}},
+		{"10s:conns=0", Stage{Duration: 10 * time.Second, Conns: 0, RPS: -1}},
+	}
+	for _, tt := range tests {
+		got, err := ParseStage(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseStage(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "-1s", "0s", "0s:c=1", "10s:c", "10s:c=x", "10s:rps=-1", "10s:foo=1"} {
+		if _, err := ParseStage(in); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	start := time.Now()
+	p := newLoadProfile(BenchParam{
+		ConnNum: 2,
+		Stages: []Stage{
+			{Duration: 10 * time.Second, Conns: -1, RPS: 500},
+			{Duration: 20 * time.Second, Conns: 10, RPS: -1},
+			{Duration: 10 * time.Second, Conns: 0, RPS: 0},
+		},
+	}, start)
+
+	if !p.limited {
+		t.Fatalf("expected a rate limited profile")
+	}
+	if p.duration() != 40*time.Second || p.maxConns() != 10 {
+		t.Fatalf("unexpected duration %v or max conns %d", p.duration(), p.maxConns())
+	}
+
+	tests := []struct {
+		at    time.Duration
+		stage int
+		want  stageTarget
+	}{
+		{0, 0, stageTarget{conns: 2, rps: 0}},
+		{5 * time.Second, 0, stageTarget{conns: 2, rps: 250}},
+		{20 * time.Second, 1, stageTarget{conns: 6, rps: 500}},
+		{35 * time.Second, 2, stageTarget{conns: 5, rps: 250}},
+		{time.Minute, 2, stageTarget{conns: 0, rps: 0}},
+	}
+	for _, tt := range tests {
+		stage, target := p.at(start.Add(tt.at))
+		if stage != tt.stage || target != tt.want {
+			t.Errorf("at %v: got stage %d %+v, want stage %d %+v", tt.at, stage, target, tt.stage, tt.want)
+		}
+	}
+}
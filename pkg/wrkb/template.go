@@ -0,0 +1,305 @@
+package wrkb
+
+import (
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+)
+
+// placeholderKind selects the placeholders compileText recognises.
+type placeholderKind uint16
+
+const (
+	kindRandI64 placeholderKind = 1 << iota
+	kindSeqI64
+	kindRandHex
+	kindRandStr
+	kindUUID
+	kindNow
+	kindRandDate
+	kindRandF64
+	kindFake
+	kindVar
+
+	kindAll = 1<<iota - 1
+)
+
+// textTemplate is a string parsed once into literal text and placeholders,
+// so rendering it needs neither regexes nor number parsing.
+type textTemplate struct {
+	raw      string
+	segments []segment
+}
+
+// segment is literal text, a generated value or a worker variable. A
+// generated value with slot >= 0 is a named placeholder.
+type segment struct {
+	literal string
+	gen     generator
+	slot    int
+	varName string
+}
+
+// generator appends a newly generated value to dst, drawing any randomness
+// from r.
+type generator interface {
+	appendValue(dst []byte, r *mathrand.Rand) []byte
+}
+
+// compileText parses s. slots numbers named placeholders by their token, so
+// templates compiled with the same map share them.
+func compileText(s string, kinds placeholderKind, slots map[string]int) textTemplate {
+	t := textTemplate{raw: s}
+	lit := 0
+	for i := 0; i+1 < len(s); {
+		j := strings.Index(s[i:], "__")
+		if j < 0 {
+			break
+		}
+		i += j
+
+		seg, n := parsePlaceholder(s[i:], kinds, slots)
+		if n == 0 {
+			i++
+			continue
+		}
+		if lit < i {
+			t.segments = append(t.segments, segment{literal: s[lit:i], slot: -1})
+		}
+		t.segments = append(t.segments, seg)
+		i += n
+		lit = i
+	}
+
+	if len(t.segments) > 0 && lit < len(s) {
+		t.segments = append(t.segments, segment{literal: s[lit:], slot: -1})
+	}
+	return t
+}
+
+// parsePlaceholder parses the placeholder s starts with and returns its
+// length, or 0 when s does not start with one.
+func parsePlaceholder(s string, kinds placeholderKind, slots map[string]int) (segment, int) {
+	end := strings.Index(s[2:], "__")
+	if end < 0 {
+		return segment{}, 0
+	}
+	token := s[:end+4]
+	body := s[2 : end+2]
+
+	if name, ok := strings.CutPrefix(body, "VAR_"); ok {
+		if kinds&kindVar == 0 || !isWord(name) {
+			return segment{}, 0
+		}
+		return segment{varName: name, slot: -1}, len(token)
+	}
+
+	spec, name, named := strings.Cut(body, "#")
+	if named && !isWord(name) {
+		return segment{}, 0
+	}
+	gen := parseGenerator(spec, kinds)
+	if gen == nil {
+		return segment{}, 0
+	}
+
+	seg := segment{gen: gen, slot: -1}
+	if named {
+		slot, ok := slots[token]
+		if !ok {
+			slot = len(slots)
+			slots[token] = slot
+		}
+		seg.slot = slot
+	}
+	return seg, len(token)
+}
+
+// parseRange parses "<low>_<high>", swapping them when high < low.
+func parseRange(args string) (low, high int64, ok bool) {
+	l, h, found := strings.Cut(args, "_")
+	if !found || !isInt(l) || !isInt(h) {
+		return 0, 0, false
+	}
+	low, _ = strconv.ParseInt(l, 10, 64)
+	high, _ = strconv.ParseInt(h, 10, 64)
+	if high < low {
+		low, high = high, low
+	}
+	return low, high, true
+}
+
+// isInt reports a signed number of at most 19 digits.
+func isInt(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return s != "" && len(s) <= 19 && isDigits(s)
+}
+
+func parseLength(s string, maxDigits int) (int, bool) {
+	if s == "" || len(s) > maxDigits || !isDigits(s) {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(s)
+	return n, n > 0
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// static reports a template without placeholders.
+func (t *textTemplate) static() bool {
+	return len(t.segments) == 0
+}
+
+// substitution renders the templates of one request into a buffer reused
+// across requests. Every occurrence of the same named placeholder, in any
+// part of the request, gets the value generated for the first one; unnamed
+// placeholders are independent. Values are drawn from rng, the worker's
+// stream; a substitution without one seeds it from the clock on first use.
+type substitution struct {
+	rng     *mathrand.Rand
+	seq     *seqI64Stride // nil to share the SEQI64 counters of the process
+	buf     []byte
+	named   []span
+	headers []string
+}
+
+type span struct {
+	start, end int
+}
+
+// reset starts a new request.
+func (sub *substitution) reset() {
+	sub.buf = sub.buf[:0]
+	sub.named = sub.named[:0]
+}
+
+// render returns t with its placeholders and vars substituted. A template
+// without placeholders is returned as is.
+func (sub *substitution) render(t *textTemplate, vars map[string]string) string {
+	if t.static() {
+		return t.raw
+	}
+	if sub.rng == nil {
+		sub.rng = newRand(0)
+	}
+	start := len(sub.buf)
+	for i := range t.segments {
+		seg := &t.segments[i]
+		switch {
+		case seg.gen != nil && seg.slot >= 0:
+			sub.appendNamed(seg)
+		case seg.gen != nil:
+			sub.generate(seg.gen)
+		case seg.varName != "":
+			if v, ok := vars[seg.varName]; ok {
+				sub.buf = append(sub.buf, v...)
+			} else {
+				sub.buf = append(sub.buf, "__VAR_"...)
+				sub.buf = append(sub.buf, seg.varName...)
+				sub.buf = append(sub.buf, "__"...)
+			}
+		default:
+			sub.buf = append(sub.buf, seg.literal...)
+		}
+	}
+	return string(sub.buf[start:])
+}
+
+func (sub *substitution) appendNamed(seg *segment) {
+	for len(sub.named) <= seg.slot {
+		sub.named = append(sub.named, span{start: -1})
+	}
+	if v := sub.named[seg.slot]; v.start >= 0 {
+		sub.buf = append(sub.buf, sub.buf[v.start:v.end]...)
+		return
+	}
+	start := len(sub.buf)
+	sub.generate(seg.gen)
+	sub.named[seg.slot] = span{start: start, end: len(sub.buf)}
+}
+
+func (sub *substitution) generate(gen generator) {
+	if g, ok := gen.(seqI64Gen); ok && sub.seq != nil {
+		sub.buf = strconv.AppendInt(sub.buf, sub.seq.advance(g), 10)
+		return
+	}
+	sub.buf = gen.appendValue(sub.buf, sub.rng)
+}
+
+// compiledRequest is a RequestTemplate parsed for rendering, with the named
+// placeholders numbered across all its parts.
+type compiledRequest struct {
+	method  textTemplate
+	url     textTemplate
+	headers []textTemplate
+	body    textTemplate
+	// staticHeaders holds the template's headers when none has placeholders.
+	staticHeaders []string
+}
+
+func compileRequest(t *RequestTemplate) *compiledRequest {
+	slots := make(map[string]int)
+	c := &compiledRequest{
+		method:        compileText(t.Method, kindAll, slots),
+		url:           compileText(t.URL, kindAll, slots),
+		staticHeaders: t.Headers,
+	}
+	for _, h := range t.Headers {
+		ht := compileText(h, kindAll, slots)
+		if !ht.static() {
+			c.staticHeaders = nil
+		}
+		c.headers = append(c.headers, ht)
+	}
+	if c.staticHeaders != nil {
+		c.headers = nil
+	}
+	if t.rawBody {
+		c.body = textTemplate{raw: t.Body}
+	} else {
+		c.body = compileText(t.Body, kindAll, slots)
+	}
+	return c
+}
+
+// render builds the request. Its strings are allocated only for the parts
+// with placeholders, and its headers slice is reused by the next render.
+func (c *compiledRequest) render(sub *substitution, vars map[string]string) Request {
+	sub.reset()
+	req := Request{
+		Method:  sub.render(&c.method, vars),
+		URL:     sub.render(&c.url, vars),
+		Headers: c.staticHeaders,
+		Body:    sub.render(&c.body, vars),
+	}
+	if c.headers != nil {
+		sub.headers = sub.headers[:0]
+		for i := range c.headers {
+			sub.headers = append(sub.headers, sub.render(&c.headers[i], vars))
+		}
+		req.Headers = sub.headers
+	}
+	return req
+}
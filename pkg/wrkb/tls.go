@@ -0,0 +1,156 @@
+package wrkb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type TLSOptions struct {
+	InsecureSkipVerify bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	MinVersion         string
+	MaxVersion         string
+	CipherSuites       []string
+	SessionResumption  bool
+}
+
+// Config builds the client TLS config shared by all benchmark runs.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate requires both cert and key files")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(o.MinVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MaxVersion, err = parseTLSVersion(o.MaxVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, fmt.Errorf("tls min version %s is above max version %s", o.MinVersion, o.MaxVersion)
+	}
+
+	for _, name := range o.CipherSuites {
+		id, err := parseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	if o.SessionResumption {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	} else {
+		cfg.SessionTicketsDisabled = true
+	}
+
+	return cfg, nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimSpace(v) {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version: %s (use 1.0, 1.1, 1.2 or 1.3)", v)
+	}
+}
+
+func parseCipherSuite(name string) (uint16, error) {
+	name = strings.TrimSpace(name)
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, s := range suites {
+			if strings.EqualFold(s.Name, name) {
+				return s.ID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite: %s", name)
+}
+
+// clientTLSConfig returns a per-run copy of the configured TLS settings.
+func clientTLSConfig(cfg *tls.Config, nextProtos ...string) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg = cfg.Clone()
+	cfg.NextProtos = nextProtos
+	return cfg
+}
+
+func isTLSURL(url string) bool {
+	return len(url) >= 8 && strings.EqualFold(url[:8], "https://")
+}
+
+func isCleartextURL(url string) bool {
+	return len(url) >= 7 && strings.EqualFold(url[:7], "http://")
+}
+
+// handshake runs the TLS handshake on a freshly dialed connection and records
+// its duration, so transports get a ready tls.Conn.
+func (t *connTracker) handshake(conn net.Conn, cfg *tls.Config, addr string, timeout time.Duration) (net.Conn, error) {
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if timeout > 0 {
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	start := time.Now()
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, &handshakeError{err: err}
+	}
+	t.recordHandshake(time.Since(start))
+
+	_ = tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
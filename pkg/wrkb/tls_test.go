@@ -0,0 +1,52 @@
+package wrkb
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSOptions_Config(t *testing.T) {
+	cfg, err := TLSOptions{
+		ServerName:   "api.internal",
+		MinVersion:   "1.2",
+		MaxVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ServerName != "api.internal" {
+		t.Errorf("expected server name override, got %q", cfg.ServerName)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected versions: min=%x max=%x", cfg.MinVersion, cfg.MaxVersion)
+	}
+	if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites: %v", cfg.CipherSuites)
+	}
+	if !cfg.SessionTicketsDisabled || cfg.ClientSessionCache != nil {
+		t.Errorf("expected session resumption to be disabled")
+	}
+}
+
+func TestTLSOptions_ConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{"unknown version", TLSOptions{MinVersion: "2.0"}},
+		{"min above max", TLSOptions{MinVersion: "1.3", MaxVersion: "1.2"}},
+		{"unknown cipher", TLSOptions{CipherSuites: []string{"TLS_NOPE"}}},
+		{"cert without key", TLSOptions{CertFile: "client.pem"}},
+		{"missing ca file", TLSOptions{CAFile: "does-not-exist.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.Config(); err == nil {
+				t.Fatalf("expected error for %+v", tt.opts)
+			}
+		})
+	}
+}
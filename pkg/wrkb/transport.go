@@ -0,0 +1,70 @@
+package wrkb
+
+import (
+	"context"
+	"time"
+)
+
+// Transport connects BenchHTTP to a protocol. A Transport is created for every
+// benchmark run and hands out one Requester per worker; the worker loop owns
+// scheduling, rate limiting, MaxReqs and histogram recording.
+type Transport interface {
+	// Requester returns the Requester used by the given worker.
+	Requester(worker int) Requester
+	// Stat returns run-wide counters (e.g. connections) collected since the
+	// previous call; they are merged into the result.
+	Stat() BenchStat
+	Close()
+}
+
+// Requester sends one request per Do call. It is used by a single worker, so
+// it may keep per-worker buffers. ctx is cancelled when the run ends; requests
+// already in flight are expected to complete.
+type Requester interface {
+	Do(ctx context.Context, req *Request) Outcome
+}
+
+// Request is the request a worker picked for one Do call, with placeholders
+// already substituted. It is only valid until Do returns.
+type Request struct {
+	Method  string
+	URL     string
+	Headers []string
+	Body    string
+}
+
+// Outcome is the contribution of a single request to BenchStat.
+//
+// Body and Header expose the response to checks. They may be reused by the
+// next Do call, and Body may be nil unless BenchParam.Checks needs it.
+type Outcome struct {
+	Status    int
+	ReqBytes  int
+	RespBytes int
+	Body      []byte
+	Header    func(name string) (string, bool)
+	Start     time.Time
+	End       time.Time
+	Err       error
+}
+
+// NewTransportFunc creates the Transport for one benchmark run.
+type NewTransportFunc func(param BenchParam) Transport
+
+func newTransport(param BenchParam) Transport {
+	switch {
+	case param.NewTransport != nil:
+		return param.NewTransport(param)
+	case param.HTTP2 || param.H2C:
+		return newH2Transport(param)
+	default:
+		return newFastHTTPTransport(param)
+	}
+}
+
+// RequesterFunc adapts a function to the Requester interface.
+type RequesterFunc func(ctx context.Context, req *Request) Outcome
+
+func (f RequesterFunc) Do(ctx context.Context, req *Request) Outcome {
+	return f(ctx, req)
+}
@@ -41,8 +41,8 @@ func BenchWRK(connNum int, url string) BenchResult {
 			BodyRespSize: 0,
 			Time:         0,
 		},
-		RPS:     rps,
-		Latency: latency,
+		RPS:         rps,
+		LatencyStat: LatencyStat{Latency: latency},
 	}
 }
 
@@ -8,7 +8,10 @@ import (
 	"math/rand"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
 )
@@ -27,8 +30,10 @@ func Start(params []BenchParam) error {
 		return fmt.Errorf("no benchmark parameters provided")
 	}
 
+	run := time.Now()
 	var results []BenchResult
-	jsonOnly := params[0].WriteBestJSON && params[0].BestJSONPath == ""
+	jsonOnly := params[0].WriteBestJSON && params[0].BestJSONPath == "" ||
+		params[0].WriteResultsJSON && params[0].ResultsJSONPath == ""
 
 	if !jsonOnly && params[0].ProcName != "" {
 		ps, err := Ps(params[0].ProcName)
@@ -43,38 +48,97 @@ func Start(params []BenchParam) error {
 			gray, reset, humanize.Bytes(uint64(ps.BinarySize)))
 	}
 
+	cols := tableColumns(params[0])
 	if !jsonOnly {
-		printHeader()
+		printHeader(cols)
 	}
 
 	for _, p := range params {
-		results = append(results, runSingleBenchmark(p, !jsonOnly))
+		result := runSingleBenchmark(p)
+		if !jsonOnly {
+			for _, stage := range result.Stages {
+				printRow(cols, stage)
+			}
+			printRow(cols, result)
+		}
+		results = append(results, result)
 	}
 
 	if !jsonOnly {
-		printFooter()
+		printFooter(cols)
+		printFailReasons(results)
+		printStatuses(params[0], results)
+		printTemplates(params[0], results)
+		printSamples(params[0], results)
 	}
 
-	best := findBestResult(results)
+	var candidates []*BenchResult
+	for i := range results {
+		if len(results[i].Stages) == 0 {
+			candidates = append(candidates, &results[i])
+			continue
+		}
+		for j := range results[i].Stages {
+			candidates = append(candidates, &results[i].Stages[j])
+		}
+	}
+	bestResult := findBestResult(candidates)
+	bestResult.Best = true
+	best := *bestResult
 
 	if !jsonOnly {
 		icon := randomStartIcon()
 
-		latencyStr := formatDuration1(best.Latency)
-		minStr := formatDuration1(best.Min)
-		p50Str := formatDuration1(best.P50)
-		p90Str := formatDuration1(best.P90)
-		p99Str := formatDuration1(best.P99)
-		p999Str := formatDuration1(best.P999)
-		maxStr := formatDuration1(best.Max)
-
-		fmt.Printf("\n%s %s Best result:%s %d connections | %s%d RPS%s | %s%s latency%s \nmin=%-8s \np50=%-8s \np90=%-8s \np99=%-8s \np999=%-8s \nmax=%-8s\n\n",
+		fmt.Printf("\n%s %s Best result:%s %d connections | %s%d RPS%s | %s%s latency%s \n%s\n",
 			icon,
 			yellow, reset, best.Param.ConnNum,
 			green, best.RPS, reset,
-			red, latencyStr, reset,
-			minStr, p50Str, p90Str, p99Str, p999Str, maxStr,
+			red, formatDuration1(best.Latency), reset,
+			formatLatencyLines(best.LatencyStat),
 		)
+
+		if best.Stat.HandshakeCnt > 0 {
+			fmt.Printf("%s🔐 TLS handshakes:%s %d | %s%s latency%s \np50=%-8s \np99=%-8s \nmax=%-8s\n\n",
+				yellow, reset, best.Stat.HandshakeCnt,
+				red, formatDuration1(best.Handshake.Latency), reset,
+				formatDuration1(best.Handshake.Percentile(50)),
+				formatDuration1(best.Handshake.Percentile(99)),
+				formatDuration1(best.Handshake.Max),
+			)
+		}
+
+		if best.Param.OpenLoop {
+			fmt.Printf("%s⏱️  Corrected for coordinated omission:%s %s%d missed%s | %s%s latency%s \n%s\n",
+				yellow, reset,
+				red, best.Stat.MissedCnt, reset,
+				red, formatDuration1(best.Corrected.Latency), reset,
+				formatLatencyLines(best.Corrected),
+			)
+		}
+	}
+
+	if params[0].CSVPath != "" {
+		if err := writeResultsCSV(params[0].CSVPath, run, params[0].percentiles(), results); err != nil {
+			return err
+		}
+	}
+
+	if params[0].HlogPath != "" {
+		if err := writeHistogramLog(params[0].HlogPath, run, results); err != nil {
+			return err
+		}
+	}
+
+	if params[0].HgrmPrefix != "" {
+		if err := writePercentileDistributions(params[0].HgrmPrefix, results); err != nil {
+			return err
+		}
+	}
+
+	if params[0].WriteResultsJSON {
+		if err := writeResultsJSON(results, params[0].ResultsJSONPath, params[0].ResultsNDJSON); err != nil {
+			return err
+		}
 	}
 
 	if params[0].WriteBestJSON {
@@ -90,24 +154,25 @@ func Start(params []BenchParam) error {
 	return nil
 }
 
-func runSingleBenchmark(p BenchParam, showOutput bool) BenchResult {
+func runSingleBenchmark(p BenchParam) BenchResult {
 	var psBefore *PsStat
-	if p.ProcName != "" {
-		ps, err := Ps(p.ProcName)
-		if err != nil {
-			log.Printf("failed to read process stats before benchmark: %v", err)
-		} else {
-			psBefore = ps
+	var start time.Time
+
+	p.onMeasureStart = func() {
+		if p.ProcName != "" {
+			ps, err := Ps(p.ProcName)
+			if err != nil {
+				log.Printf("failed to read process stats before benchmark: %v", err)
+			} else {
+				psBefore = ps
+			}
 		}
+		start = time.Now()
 	}
 
-	start := time.Now()
 	result := BenchHTTP(p)
 	elapsed := time.Since(start)
-
-	var cpu float64
-	var thr int
-	var mem int64
+	result.Start, result.Elapsed = start, elapsed
 
 	if p.ProcName != "" {
 		psAfter, err := Ps(p.ProcName)
@@ -115,53 +180,393 @@ func runSingleBenchmark(p BenchParam, showOutput bool) BenchResult {
 			log.Printf("failed to read process stats after benchmark: %v", err)
 		} else {
 			if psBefore != nil {
-				cpu = (psAfter.CPUTime - psBefore.CPUTime) / elapsed.Seconds()
+				result.CPU = (psAfter.CPUTime - psBefore.CPUTime) / elapsed.Seconds()
 			}
-			thr = psAfter.CPUNumThreads
-			mem = int64(psAfter.MemRSS)
+			result.Threads = psAfter.CPUNumThreads
+			result.MemRSS = int64(psAfter.MemRSS)
 		}
 	}
 
-	if showOutput {
-		printRow(result, cpu, thr, mem)
-	}
 	return result
 }
 
-func printHeader() {
-	fmt.Printf("\n%s┌────┬────────┬────────┬────────┬────────┬────────┬─────────┬─────────┬─────┬────┬────────┐%s\n", gray, reset)
-	fmt.Printf("%s│%4s│%8s│%8s│%8s│%8s│%8s│%9s│%9s│%5s│%4s│%8s│%s\n",
-		gray, "conn", "rps", "latency", "good", "bad", "err", "body req", "body resp", "cpu", "thr", "mem", reset)
-	fmt.Printf("%s├────┼────────┼────────┼────────┼────────┼────────┼─────────┼─────────┼─────┼────┼────────┤%s\n", gray, reset)
-}
-
-func printRow(result BenchResult, cpu float64, threads int, memRSS int64) {
-	bodyReqSize := humanize.Bytes(uint64(result.Stat.BodyReqSize))
-	bodyRespSize := humanize.Bytes(uint64(result.Stat.BodyRespSize))
-	fmt.Printf("│%4d│%s%8d%s│%s%8s%s│%8d│%8d│%8d│%9s│%9s│%s%5.2f%s│%4d│%8s│\n",
-		result.Param.ConnNum,
-		green, result.RPS, reset,
-		red, formatDuration1(result.Latency), reset,
-		result.Stat.GoodCnt, result.Stat.BadCnt, result.Stat.ErrorCnt,
-		bodyReqSize,
-		bodyRespSize,
-		yellow, cpu, reset,
-		threads,
-		humanize.Bytes(uint64(memRSS)),
+type tableColumn[T any] struct {
+	title string
+	width int
+	color string
+	value func(r T) string
+}
+
+func tableColumns(p BenchParam) []tableColumn[BenchResult] {
+	itoa := strconv.Itoa
+	var cols []tableColumn[BenchResult]
+
+	if len(p.Stages) > 0 {
+		cols = append(cols, tableColumn[BenchResult]{"stage", 5, cyan, func(r BenchResult) string {
+			if r.Stage == 0 {
+				return "total"
+			}
+			return itoa(r.Stage)
+		}})
+	}
+
+	cols = append(cols, []tableColumn[BenchResult]{
+		{"conn", 4, "", func(r BenchResult) string { return itoa(r.Param.ConnNum) }},
+		{"rps", 8, green, func(r BenchResult) string { return itoa(r.RPS) }},
+		{"latency", 8, red, func(r BenchResult) string { return formatDuration1(r.Latency) }},
+		{"good", 8, "", func(r BenchResult) string { return itoa(r.Stat.GoodCnt) }},
+		{"redir", 6, "", func(r BenchResult) string { return itoa(r.Stat.RedirectCnt) }},
+		{"bad", 8, "", func(r BenchResult) string { return itoa(r.Stat.BadCnt) }},
+	}...)
+
+	if p.countsFailed() {
+		cols = append(cols, tableColumn[BenchResult]{"failed", 8, "", func(r BenchResult) string { return itoa(r.Stat.FailedCnt) }})
+	}
+
+	cols = append(cols, tableColumn[BenchResult]{"err", 8, "", func(r BenchResult) string { return itoa(r.Stat.ErrorCnt) }})
+
+	for k := ErrorKind(0); k < errorKindCount; k++ {
+		cols = append(cols, tableColumn[BenchResult]{k.String(), 7, "", func(r BenchResult) string { return itoa(r.Stat.ErrorKindCnt[k]) }})
+	}
+
+	if p.OpenLoop {
+		cols = append(cols,
+			tableColumn[BenchResult]{"missed", 8, "", func(r BenchResult) string { return itoa(r.Stat.MissedCnt) }},
+			tableColumn[BenchResult]{"cor p99", 8, red, func(r BenchResult) string { return formatDuration1(correctedP99(r)) }},
+		)
+	}
+
+	cols = append(cols,
+		tableColumn[BenchResult]{"open", 6, "", func(r BenchResult) string { return itoa(r.Stat.ConnOpenCnt) }},
+		tableColumn[BenchResult]{"reuse", 8, "", func(r BenchResult) string { return itoa(r.Stat.ConnReuseCnt) }},
+		tableColumn[BenchResult]{"srv cls", 7, "", func(r BenchResult) string { return itoa(r.Stat.ConnCloseCnt) }},
+	)
+
+	if p.usesTLS() {
+		cols = append(cols,
+			tableColumn[BenchResult]{"tls hs", 6, "", func(r BenchResult) string { return itoa(r.Stat.HandshakeCnt) }},
+			tableColumn[BenchResult]{"hs lat", 8, red, func(r BenchResult) string { return formatDuration1(r.Handshake.Latency) }},
+		)
+	}
+
+	if p.HTTP2 || p.H2C {
+		cols = append(cols,
+			tableColumn[BenchResult]{"streams", 8, "", func(r BenchResult) string { return itoa(r.Stat.StreamCnt) }},
+		)
+	}
+
+	return append(cols,
+		tableColumn[BenchResult]{"body req", 9, "", func(r BenchResult) string { return humanize.Bytes(uint64(r.Stat.BodyReqSize)) }},
+		tableColumn[BenchResult]{"body resp", 9, "", func(r BenchResult) string { return humanize.Bytes(uint64(r.Stat.BodyRespSize)) }},
+		tableColumn[BenchResult]{"cpu", 5, yellow, func(r BenchResult) string { return fmt.Sprintf("%.2f", r.CPU) }},
+		tableColumn[BenchResult]{"thr", 4, "", func(r BenchResult) string { return itoa(r.Threads) }},
+		tableColumn[BenchResult]{"mem", 8, "", func(r BenchResult) string { return humanize.Bytes(uint64(r.MemRSS)) }},
+	)
+}
+
+// correctedP99 is the corrected latency in the table, whatever the reported
+// percentiles.
+func correctedP99(r BenchResult) time.Duration {
+	if r.Stat.CorrectedHistogram == nil {
+		return 0
+	}
+	return time.Duration(r.Stat.CorrectedHistogram.ValueAtQuantile(99))
+}
+
+func tableLine[T any](cols []tableColumn[T], left, mid, right string) string {
+	var b strings.Builder
+	b.WriteString(left)
+	for i, c := range cols {
+		if i > 0 {
+			b.WriteString(mid)
+		}
+		b.WriteString(strings.Repeat("─", c.width))
+	}
+	b.WriteString(right)
+	return b.String()
+}
+
+func printHeader[T any](cols []tableColumn[T]) {
+	fmt.Printf("\n%s%s%s\n", gray, tableLine(cols, "┌", "┬", "┐"), reset)
+	fmt.Printf("%s│", gray)
+	for _, c := range cols {
+		fmt.Printf("%*s│", c.width, c.title)
+	}
+	fmt.Printf("%s\n", reset)
+	fmt.Printf("%s%s%s\n", gray, tableLine(cols, "├", "┼", "┤"), reset)
+}
+
+func printRow[T any](cols []tableColumn[T], result T) {
+	fmt.Printf("│")
+	for _, c := range cols {
+		if c.color != "" {
+			fmt.Printf("%s%*s%s│", c.color, c.width, c.value(result), reset)
+		} else {
+			fmt.Printf("%*s│", c.width, c.value(result))
+		}
+	}
+	fmt.Printf("\n")
+}
+
+func printFooter[T any](cols []tableColumn[T]) {
+	fmt.Printf("%s%s%s\n", gray, tableLine(cols, "└", "┴", "┘"), reset)
+}
+
+func printFailReasons(results []BenchResult) {
+	var reasons []string
+	for _, r := range results {
+		for _, reason := range r.Stat.FailReasons {
+			reasons = addFailReason(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s❗ Failed checks:%s\n", red, reset)
+	for _, reason := range reasons {
+		fmt.Printf("   - %s\n", reason)
+	}
+}
+
+// statusRow is a status class of a result, or its transport errors.
+type statusRow struct {
+	result BenchResult
+	class  string
+	count  int
+	LatencyStat
+	// codes lists the status codes or error kinds of the class with
+	// their counts, e.g. "200:950 204:50".
+	codes string
+}
+
+func statusRows(p BenchParam, r BenchResult) []statusRow {
+	var rows []statusRow
+	for c, h := range r.Stat.StatusHistograms {
+		if h == nil || h.TotalCount() == 0 {
+			continue
+		}
+		row := statusRow{result: r, class: fmt.Sprintf("%dxx", c+1), LatencyStat: calcLatencyStat(h, p.percentiles())}
+		var codes []int
+		for code := range r.Stat.StatusCnt {
+			if statusClass(code) == c {
+				codes = append(codes, code)
+			}
+		}
+		sort.Ints(codes)
+		var parts []string
+		for _, code := range codes {
+			row.count += r.Stat.StatusCnt[code]
+			parts = append(parts, fmt.Sprintf("%d:%d", code, r.Stat.StatusCnt[code]))
+		}
+		row.codes = strings.Join(parts, " ")
+		rows = append(rows, row)
+	}
+
+	if r.Stat.ErrorCnt > 0 {
+		row := statusRow{result: r, class: "err", count: r.Stat.ErrorCnt}
+		var parts []string
+		for k := ErrorKind(0); k < errorKindCount; k++ {
+			if n := r.Stat.ErrorKindCnt[k]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%s:%d", k, n))
+			}
+		}
+		row.codes = strings.Join(parts, " ")
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func statusColumns(p BenchParam, rows []statusRow) []tableColumn[statusRow] {
+	itoa := strconv.Itoa
+	var cols []tableColumn[statusRow]
+
+	if len(p.Stages) > 0 {
+		cols = append(cols, tableColumn[statusRow]{"stage", 5, cyan, func(r statusRow) string {
+			if r.result.Stage == 0 {
+				return "total"
+			}
+			return itoa(r.result.Stage)
+		}})
+	}
+
+	cols = append(cols, []tableColumn[statusRow]{
+		{"conn", 4, "", func(r statusRow) string { return itoa(r.result.Param.ConnNum) }},
+		{"class", 5, "", func(r statusRow) string { return r.class }},
+		{"count", 8, "", func(r statusRow) string { return itoa(r.count) }},
+		{"share", 7, "", func(r statusRow) string {
+			return fmt.Sprintf("%.2f%%", float64(r.count)/float64(r.result.Stat.requests())*100)
+		}},
+		{"latency", 8, red, func(r statusRow) string { return formatDuration1(r.Latency) }},
+	}...)
+	for _, pct := range p.percentiles() {
+		cols = append(cols, tableColumn[statusRow]{percentileLabel(pct), 8, red, func(r statusRow) string { return formatDuration1(r.Percentile(pct)) }})
+	}
+
+	width := 8
+	for _, r := range rows {
+		width = max(width, min(utf8.RuneCountInString(r.codes), maxTemplateNameWidth))
+	}
+	return append(cols,
+		tableColumn[statusRow]{"max", 8, red, func(r statusRow) string { return formatDuration1(r.Max) }},
+		tableColumn[statusRow]{"codes", width, "", func(r statusRow) string { return truncate(r.codes, width) }},
+	)
+}
+
+// printStatuses breaks every level, and every stage before the total of a
+// staged level, down by status class, with the latencies of the class and
+// the counts of its status codes. Transport errors get an err row.
+func printStatuses(p BenchParam, results []BenchResult) {
+	var rows []statusRow
+	for _, r := range results {
+		for _, stage := range r.Stages {
+			rows = append(rows, statusRows(p, stage)...)
+		}
+		rows = append(rows, statusRows(p, r)...)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s🚦 Status codes:%s\n", cyan, reset)
+	cols := statusColumns(p, rows)
+	printHeader(cols)
+	for _, row := range rows {
+		printRow(cols, row)
+	}
+	printFooter(cols)
+}
+
+type templateRow struct {
+	result   BenchResult
+	template TemplateResult
+}
+
+func templateColumns(p BenchParam) []tableColumn[templateRow] {
+	itoa := strconv.Itoa
+	width := 8
+	requests, _ := flattenTemplates(p.Scenario)
+	for _, t := range requests {
+		width = max(width, min(utf8.RuneCountInString(t.Name), maxTemplateNameWidth))
+	}
+
+	cols := []tableColumn[templateRow]{
+		{"conn", 4, "", func(r templateRow) string { return itoa(r.result.Param.ConnNum) }},
+		{"template", width, "", func(r templateRow) string { return truncate(r.template.Template.Name, width) }},
+		{"weight", 6, "", func(r templateRow) string { return itoa(r.template.Template.Weight) }},
+		{"rps", 8, green, func(r templateRow) string { return itoa(r.template.RPS) }},
+		{"latency", 8, red, func(r templateRow) string { return formatDuration1(r.template.Latency) }},
+	}
+	for _, pct := range p.percentiles() {
+		cols = append(cols, tableColumn[templateRow]{percentileLabel(pct), 8, red, func(r templateRow) string { return formatDuration1(r.template.Percentile(pct)) }})
+	}
+	cols = append(cols,
+		tableColumn[templateRow]{"good", 8, "", func(r templateRow) string { return itoa(r.template.Stat.GoodCnt) }},
+		tableColumn[templateRow]{"redir", 6, "", func(r templateRow) string { return itoa(r.template.Stat.RedirectCnt) }},
+		tableColumn[templateRow]{"bad", 8, "", func(r templateRow) string { return itoa(r.template.Stat.BadCnt) }},
 	)
+
+	if p.countsFailed() {
+		cols = append(cols, tableColumn[templateRow]{"failed", 8, "", func(r templateRow) string { return itoa(r.template.Stat.FailedCnt) }})
+	}
+
+	return append(cols, tableColumn[templateRow]{"err", 8, "", func(r templateRow) string { return itoa(r.template.Stat.ErrorCnt) }})
+}
+
+const maxTemplateNameWidth = 48
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func printTemplates(p BenchParam, results []BenchResult) {
+	var rows []templateRow
+	for _, r := range results {
+		for _, t := range r.Templates {
+			rows = append(rows, templateRow{result: r, template: t})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s🧩 Templates:%s\n", cyan, reset)
+	cols := templateColumns(p)
+	printHeader(cols)
+	for _, row := range rows {
+		printRow(cols, row)
+	}
+	printFooter(cols)
+}
+
+type sampleRow struct {
+	result BenchResult
+	sample Sample
+}
+
+func sampleColumns(p BenchParam) []tableColumn[sampleRow] {
+	itoa := strconv.Itoa
+	var cols []tableColumn[sampleRow]
+
+	if len(p.Stages) > 0 {
+		cols = append(cols, tableColumn[sampleRow]{"stage", 5, cyan, func(r sampleRow) string { return itoa(r.result.Stage) }})
+	}
+
+	cols = append(cols, []tableColumn[sampleRow]{
+		{"conn", 4, "", func(r sampleRow) string { return itoa(r.result.Param.ConnNum) }},
+		{"time", 8, "", func(r sampleRow) string { return formatDuration1(r.sample.Offset) }},
+		{"rps", 8, green, func(r sampleRow) string { return itoa(r.sample.RPS) }},
+		{"good", 8, "", func(r sampleRow) string { return itoa(r.sample.Good) }},
+		{"redir", 6, "", func(r sampleRow) string { return itoa(r.sample.Redirect) }},
+		{"bad", 8, "", func(r sampleRow) string { return itoa(r.sample.Bad) }},
+	}...)
+
+	if p.countsFailed() {
+		cols = append(cols, tableColumn[sampleRow]{"failed", 8, "", func(r sampleRow) string { return itoa(r.sample.Failed) }})
+	}
+
+	cols = append(cols, tableColumn[sampleRow]{"err", 8, "", func(r sampleRow) string { return itoa(r.sample.Error) }})
+	for _, pct := range p.percentiles() {
+		cols = append(cols, tableColumn[sampleRow]{percentileLabel(pct), 8, red, func(r sampleRow) string { return formatDuration1(r.sample.Percentile(pct)) }})
+	}
+	return append(cols, tableColumn[sampleRow]{"max", 8, red, func(r sampleRow) string { return formatDuration1(r.sample.Max) }})
 }
 
-func printFooter() {
-	fmt.Printf("%s└────┴────────┴────────┴────────┴────────┴────────┴─────────┴─────────┴─────┴────┴────────┘%s\n", gray, reset)
+func printSamples(p BenchParam, results []BenchResult) {
+	var rows []sampleRow
+	for _, r := range results {
+		levels := r.Stages
+		if len(levels) == 0 {
+			levels = []BenchResult{r}
+		}
+		for _, level := range levels {
+			for _, sample := range level.Samples {
+				rows = append(rows, sampleRow{result: level, sample: sample})
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s📈 Samples every %v:%s\n", cyan, p.SampleInterval, reset)
+	cols := sampleColumns(p)
+	printHeader(cols)
+	for _, row := range rows {
+		printRow(cols, row)
+	}
+	printFooter(cols)
 }
 
 func randomStartIcon() string {
 	icons := []string{"✨", "🌟", "💫", "⚡️", "🚀", "🔥", "🏅", "💎"}
-	rand.Seed(time.Now().UnixNano())
 	return icons[rand.Intn(len(icons))]
 }
 
-func findBestResult(stats []BenchResult) BenchResult {
+func findBestResult(stats []*BenchResult) *BenchResult {
 	sort.Slice(stats, func(i, j int) bool {
 		w1 := float64(stats[i].RPS) / math.Log10(float64(stats[i].Latency.Nanoseconds()))
 		w2 := float64(stats[j].RPS) / math.Log10(float64(stats[j].Latency.Nanoseconds()))
@@ -170,55 +575,247 @@ func findBestResult(stats []BenchResult) BenchResult {
 	return stats[0]
 }
 
-type bestResultJSON struct {
-	ProcName      string  `json:"proc_name,omitempty" csv:"proc_name"`
-	URL           string  `json:"url" csv:"url"`
-	Method        string  `json:"method" csv:"method"`
-	Connections   int     `json:"connections" csv:"connections"`
-	Duration      int64   `json:"duration" csv:"duration" cmpKind:"duration"`
-	RPSLimit      float64 `json:"rps_limit,omitempty" csv:"rps_limit"`
-	MaxRequests   int     `json:"max_requests,omitempty" csv:"max_requests"`
-	RPS           int     `json:"rps" csv:"rps" cmpBetter:"higher"`
-	Latency       int64   `json:"latency" csv:"latency" cmpKind:"duration" cmpBetter:"lower"`
-	Min           int64   `json:"min" csv:"min" cmpKind:"duration" cmpBetter:"lower"`
-	P50           int64   `json:"p50" csv:"p50" cmpKind:"duration" cmpBetter:"lower"`
-	P90           int64   `json:"p90" csv:"p90" cmpKind:"duration" cmpBetter:"lower"`
-	P99           int64   `json:"p99" csv:"p99" cmpKind:"duration" cmpBetter:"lower"`
-	P999          int64   `json:"p999" csv:"p999" cmpKind:"duration" cmpBetter:"lower"`
-	Max           int64   `json:"max" csv:"max" cmpKind:"duration" cmpBetter:"lower"`
-	Good          int     `json:"good" csv:"good" cmpBetter:"higher"`
-	Bad           int     `json:"bad" csv:"bad" cmpBetter:"lower"`
-	Error         int     `json:"error" csv:"error" cmpBetter:"lower"`
-	BodyReqBytes  int     `json:"body_req_bytes" csv:"body_req_bytes"`
-	BodyRespBytes int     `json:"body_resp_bytes" csv:"body_resp_bytes"`
-	Time          int64   `json:"time" csv:"time" cmpKind:"duration" cmpBetter:"lower"`
+// resultJSON is a BenchResult as written by --best-json and --json; compare
+// diffs the fields with a csv tag. Durations are in microseconds.
+type resultJSON struct {
+	ProcName             string           `json:"proc_name,omitempty" csv:"proc_name"`
+	URL                  string           `json:"url" csv:"url"`
+	Method               string           `json:"method" csv:"method"`
+	Connections          int              `json:"connections" csv:"connections"`
+	Duration             int64            `json:"duration" csv:"duration" cmpKind:"duration"`
+	RPSLimit             float64          `json:"rps_limit,omitempty" csv:"rps_limit"`
+	MaxRequests          int              `json:"max_requests,omitempty" csv:"max_requests"`
+	OpenLoop             bool             `json:"open_loop,omitempty"`
+	Warmup               int64            `json:"warmup,omitempty"`
+	WarmupReqs           int              `json:"warmup_reqs,omitempty"`
+	Seed                 int64            `json:"seed,omitempty"`
+	Stage                int              `json:"stage,omitempty"`
+	Best                 bool             `json:"best,omitempty"`
+	RPS                  int              `json:"rps" csv:"rps" cmpBetter:"higher"`
+	Latency              int64            `json:"latency" csv:"latency" cmpKind:"duration" cmpBetter:"lower"`
+	Min                  int64            `json:"min" csv:"min" cmpKind:"duration" cmpBetter:"lower"`
+	Percentiles          map[string]int64 `json:"percentiles" csv:"percentiles" cmpKind:"duration" cmpBetter:"lower"`
+	Max                  int64            `json:"max" csv:"max" cmpKind:"duration" cmpBetter:"lower"`
+	Good                 int              `json:"good" csv:"good" cmpBetter:"higher"`
+	Redirect             int              `json:"redirect" csv:"redirect"`
+	Bad                  int              `json:"bad" csv:"bad" cmpBetter:"lower"`
+	Failed               int              `json:"failed" csv:"failed" cmpBetter:"lower"`
+	FailReasons          []string         `json:"fail_reasons,omitempty"`
+	Error                int              `json:"error" csv:"error" cmpBetter:"lower"`
+	ErrTimeout           int              `json:"err_timeout" csv:"err_timeout" cmpBetter:"lower"`
+	ErrRefused           int              `json:"err_refused" csv:"err_refused" cmpBetter:"lower"`
+	ErrReset             int              `json:"err_reset" csv:"err_reset" cmpBetter:"lower"`
+	ErrDNS               int              `json:"err_dns" csv:"err_dns" cmpBetter:"lower"`
+	ErrTLS               int              `json:"err_tls" csv:"err_tls" cmpBetter:"lower"`
+	ErrOther             int              `json:"err_other" csv:"err_other" cmpBetter:"lower"`
+	StatusCodes          map[string]int   `json:"status_codes,omitempty" csv:"status_codes" cmpPrefix:"status_"`
+	Missed               int              `json:"missed,omitempty" csv:"missed" cmpBetter:"lower" cmpOmitEmpty:"true"`
+	CorrectedPercentiles map[string]int64 `json:"corrected_percentiles,omitempty" csv:"corrected_percentiles" cmpPrefix:"corrected_" cmpKind:"duration" cmpBetter:"lower"`
+	CorrectedMax         int64            `json:"corrected_max,omitempty" csv:"corrected_max" cmpKind:"duration" cmpBetter:"lower" cmpOmitEmpty:"true"`
+	Handshakes           int              `json:"handshakes,omitempty" csv:"handshakes" cmpOmitEmpty:"true"`
+	HandshakeP50         int64            `json:"handshake_p50,omitempty" csv:"handshake_p50" cmpKind:"duration" cmpBetter:"lower" cmpOmitEmpty:"true"`
+	HandshakeP99         int64            `json:"handshake_p99,omitempty" csv:"handshake_p99" cmpKind:"duration" cmpBetter:"lower" cmpOmitEmpty:"true"`
+	BodyReqBytes         int              `json:"body_req_bytes" csv:"body_req_bytes"`
+	BodyRespBytes        int              `json:"body_resp_bytes" csv:"body_resp_bytes"`
+	Time                 int64            `json:"time" csv:"time" cmpKind:"duration" cmpBetter:"lower"`
+	Elapsed              int64            `json:"elapsed,omitempty"`
+	CPU                  float64          `json:"cpu,omitempty" csv:"cpu" cmpOmitEmpty:"true"`
+	Threads              int              `json:"threads,omitempty" csv:"threads" cmpOmitEmpty:"true"`
+	MemRSS               int64            `json:"mem_rss,omitempty" csv:"mem_rss" cmpOmitEmpty:"true"`
+	Samples              []sampleJSON     `json:"samples,omitempty"`
+	Templates            []templateJSON   `json:"templates,omitempty"`
+	Stages               []resultJSON     `json:"stages,omitempty"`
 }
 
-func writeBestResultJSON(best BenchResult, path string, compare bool) ([]compareRow, error) {
-	payload := bestResultJSON{
-		ProcName:      best.Param.ProcName,
-		URL:           best.Param.URL,
-		Method:        best.Param.Method,
-		Connections:   best.Param.ConnNum,
-		Duration:      best.Param.Duration.Microseconds(),
-		RPSLimit:      best.Param.RPSLimit,
-		MaxRequests:   best.Param.MaxReqs,
-		RPS:           best.RPS,
-		Latency:       best.Latency.Microseconds(),
-		Min:           best.Min.Microseconds(),
-		P50:           best.P50.Microseconds(),
-		P90:           best.P90.Microseconds(),
-		P99:           best.P99.Microseconds(),
-		P999:          best.P999.Microseconds(),
-		Max:           best.Max.Microseconds(),
-		Good:          best.Stat.GoodCnt,
-		Bad:           best.Stat.BadCnt,
-		Error:         best.Stat.ErrorCnt,
-		BodyReqBytes:  best.Stat.BodyReqSize,
-		BodyRespBytes: best.Stat.BodyRespSize,
-		Time:          best.Stat.Time.Microseconds(),
+type templateJSON struct {
+	Name        string           `json:"name"`
+	Method      string           `json:"method"`
+	URL         string           `json:"url"`
+	Weight      int              `json:"weight"`
+	RPS         int              `json:"rps"`
+	Latency     int64            `json:"latency"`
+	Min         int64            `json:"min"`
+	Percentiles map[string]int64 `json:"percentiles"`
+	Max         int64            `json:"max"`
+	Good        int              `json:"good"`
+	Redirect    int              `json:"redirect"`
+	Bad         int              `json:"bad"`
+	Failed      int              `json:"failed"`
+	Error       int              `json:"error"`
+}
+
+// percentilesJSON maps the labels of the percentiles of s, such as p99.9, to
+// their latencies in microseconds.
+func percentilesJSON(s LatencyStat) map[string]int64 {
+	if len(s.Percentiles) == 0 {
+		return nil
+	}
+	out := make(map[string]int64, len(s.Percentiles))
+	for _, p := range s.Percentiles {
+		out[percentileLabel(p.Percentile)] = p.Value.Microseconds()
+	}
+	return out
+}
+
+// statusCodesJSON keys the response counts by status code.
+func statusCodesJSON(counts map[int]int) map[string]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(counts))
+	for code, n := range counts {
+		out[strconv.Itoa(code)] = n
+	}
+	return out
+}
+
+func templatesJSON(templates []TemplateResult) []templateJSON {
+	var out []templateJSON
+	for _, t := range templates {
+		out = append(out, templateJSON{
+			Name:        t.Template.Name,
+			Method:      t.Template.Method,
+			URL:         t.Template.URL,
+			Weight:      t.Template.Weight,
+			RPS:         t.RPS,
+			Latency:     t.Latency.Microseconds(),
+			Min:         t.Min.Microseconds(),
+			Percentiles: percentilesJSON(t.LatencyStat),
+			Max:         t.Max.Microseconds(),
+			Good:        t.Stat.GoodCnt,
+			Redirect:    t.Stat.RedirectCnt,
+			Bad:         t.Stat.BadCnt,
+			Failed:      t.Stat.FailedCnt,
+			Error:       t.Stat.ErrorCnt,
+		})
+	}
+	return out
+}
+
+type sampleJSON struct {
+	Offset      int64            `json:"offset"`
+	Duration    int64            `json:"duration"`
+	RPS         int              `json:"rps"`
+	Good        int              `json:"good"`
+	Redirect    int              `json:"redirect"`
+	Bad         int              `json:"bad"`
+	Failed      int              `json:"failed"`
+	Error       int              `json:"error"`
+	Percentiles map[string]int64 `json:"percentiles"`
+	Max         int64            `json:"max"`
+}
+
+func samplesJSON(samples []Sample) []sampleJSON {
+	var out []sampleJSON
+	for _, s := range samples {
+		out = append(out, sampleJSON{
+			Offset:      s.Offset.Microseconds(),
+			Duration:    s.Duration.Microseconds(),
+			RPS:         s.RPS,
+			Good:        s.Good,
+			Redirect:    s.Redirect,
+			Bad:         s.Bad,
+			Failed:      s.Failed,
+			Error:       s.Error,
+			Percentiles: percentilesJSON(s.LatencyStat),
+			Max:         s.Max.Microseconds(),
+		})
+	}
+	return out
+}
+
+func newResultJSON(r BenchResult) resultJSON {
+	payload := resultJSON{
+		ProcName:             r.Param.ProcName,
+		URL:                  r.Param.URL,
+		Method:               r.Param.Method,
+		Connections:          r.Param.ConnNum,
+		Duration:             r.Param.Duration.Microseconds(),
+		RPSLimit:             r.Param.RPSLimit,
+		MaxRequests:          r.Param.MaxReqs,
+		OpenLoop:             r.Param.OpenLoop,
+		Warmup:               r.Param.Warmup.Microseconds(),
+		WarmupReqs:           r.Param.WarmupReqs,
+		Seed:                 r.Param.Seed,
+		Stage:                r.Stage,
+		Best:                 r.Best,
+		RPS:                  r.RPS,
+		Latency:              r.Latency.Microseconds(),
+		Min:                  r.Min.Microseconds(),
+		Percentiles:          percentilesJSON(r.LatencyStat),
+		Max:                  r.Max.Microseconds(),
+		Good:                 r.Stat.GoodCnt,
+		Redirect:             r.Stat.RedirectCnt,
+		Bad:                  r.Stat.BadCnt,
+		Failed:               r.Stat.FailedCnt,
+		FailReasons:          r.Stat.FailReasons,
+		Error:                r.Stat.ErrorCnt,
+		ErrTimeout:           r.Stat.ErrorKindCnt[ErrKindTimeout],
+		ErrRefused:           r.Stat.ErrorKindCnt[ErrKindRefused],
+		ErrReset:             r.Stat.ErrorKindCnt[ErrKindReset],
+		ErrDNS:               r.Stat.ErrorKindCnt[ErrKindDNS],
+		ErrTLS:               r.Stat.ErrorKindCnt[ErrKindTLS],
+		ErrOther:             r.Stat.ErrorKindCnt[ErrKindOther],
+		StatusCodes:          statusCodesJSON(r.Stat.StatusCnt),
+		Missed:               r.Stat.MissedCnt,
+		CorrectedPercentiles: percentilesJSON(r.Corrected),
+		CorrectedMax:         r.Corrected.Max.Microseconds(),
+		Handshakes:           r.Stat.HandshakeCnt,
+		HandshakeP50:         r.Handshake.Percentile(50).Microseconds(),
+		HandshakeP99:         r.Handshake.Percentile(99).Microseconds(),
+		BodyReqBytes:         r.Stat.BodyReqSize,
+		BodyRespBytes:        r.Stat.BodyRespSize,
+		Time:                 r.Stat.Time.Microseconds(),
+		Elapsed:              r.Elapsed.Microseconds(),
+		CPU:                  r.CPU,
+		Threads:              r.Threads,
+		MemRSS:               r.MemRSS,
+		Samples:              samplesJSON(r.Samples),
+		Templates:            templatesJSON(r.Templates),
 	}
 
+	for _, stage := range r.Stages {
+		payload.Stages = append(payload.Stages, newResultJSON(stage))
+	}
+	return payload
+}
+
+// writeResultsJSON writes every result, stages included, to path (stdout when
+// empty): one JSON document, or one line per result with ndjson.
+func writeResultsJSON(results []BenchResult, path string, ndjson bool) error {
+	var data []byte
+	if ndjson {
+		for _, r := range results {
+			line, err := json.Marshal(newResultJSON(r))
+			if err != nil {
+				return err
+			}
+			data = append(append(data, line...), '\n')
+		}
+	} else {
+		payload := struct {
+			Results []resultJSON `json:"results"`
+		}{}
+		for _, r := range results {
+			payload.Results = append(payload.Results, newResultJSON(r))
+		}
+		var err error
+		if data, err = json.MarshalIndent(payload, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func writeBestResultJSON(best BenchResult, path string, compare bool) ([]compareRow, error) {
+	payload := newResultJSON(best)
+
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		return nil, err
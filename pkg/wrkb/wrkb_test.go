@@ -0,0 +1,74 @@
+package wrkb
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteResultsJSON(t *testing.T) {
+	ms := LatencyStat{Latency: time.Millisecond}
+	results := []BenchResult{
+		{Param: BenchParam{ConnNum: 1, Seed: 7}, RPS: 100, LatencyStat: ms, CPU: 0.5, Threads: 4, MemRSS: 1 << 20, Elapsed: time.Second},
+		{Param: BenchParam{ConnNum: 8}, RPS: 700, LatencyStat: ms, Stages: []BenchResult{
+			{Param: BenchParam{ConnNum: 4}, RPS: 400, LatencyStat: ms, Stage: 1},
+			{Param: BenchParam{ConnNum: 8}, RPS: 800, LatencyStat: ms, Stage: 2},
+		}},
+	}
+	candidates := []*BenchResult{&results[0], &results[1].Stages[0], &results[1].Stages[1]}
+	findBestResult(candidates).Best = true
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.json")
+	if err := writeResultsJSON(results, path, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Results []resultJSON `json:"results"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Results) != 2 || len(doc.Results[1].Stages) != 2 {
+		t.Fatalf("expected 2 results, the second with 2 stages, got %+v", doc.Results)
+	}
+	first := doc.Results[0]
+	if first.Connections != 1 || first.Seed != 7 || first.CPU != 0.5 || first.Threads != 4 || first.MemRSS != 1<<20 || first.Elapsed != 1e6 {
+		t.Errorf("unexpected params or process metrics %+v", first)
+	}
+	if first.Best || doc.Results[1].Best || doc.Results[1].Stages[0].Best || !doc.Results[1].Stages[1].Best {
+		t.Errorf("expected stage 2 of the second result marked best")
+	}
+	if doc.Results[1].Stages[1].Stage != 2 {
+		t.Errorf("expected stage number 2, got %d", doc.Results[1].Stages[1].Stage)
+	}
+
+	path = filepath.Join(dir, "results.ndjson")
+	if err := writeResultsJSON(results, path, true); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []resultJSON
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var r resultJSON
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("line %d: %v", len(lines)+1, err)
+		}
+		lines = append(lines, r)
+	}
+	if len(lines) != 2 || lines[1].RPS != 700 || !lines[1].Stages[1].Best {
+		t.Errorf("unexpected ndjson results %+v", lines)
+	}
+}